@@ -0,0 +1,161 @@
+package cert
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"time"
+
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// DefaultCSRPollInterval is how often the CertificateSigningRequest is checked for the issued certificate
+	DefaultCSRPollInterval = 2 * time.Second
+	// DefaultCSRTimeout is how long the issued certificate is waited for
+	DefaultCSRTimeout = 5 * time.Minute
+)
+
+// CSRIssuer issues the serving certificate through the certificates.k8s.io CertificateSigningRequest API, for
+// clusters where a self-signed CA is not allowed. The private key never leaves the server; the CA of the signer,
+// usually the cluster CA, is used as the CA bundle.
+type CSRIssuer struct {
+	Client       kubernetes.Interface
+	Name         string  // prefix of the name of the CertificateSigningRequests, completed by the API server
+	SignerName   string  // signer of the certificate, e.g. a signer of the cluster for serving certificates
+	Options      Options // key type and size, names and requested validity of the certificate
+	CACert       []byte  // PEM encoded CA of the signer, used as the CA bundle
+	AutoApprove  bool    // approve the request, the service account needs the approve permission on the signer
+	PollInterval time.Duration
+	Timeout      time.Duration
+}
+
+// Issue creates a private key, submits a CertificateSigningRequest for it and waits for the issued certificate
+func (i *CSRIssuer) Issue(ctx context.Context) (*KeyPair, error) {
+	if i.SignerName == "" {
+		return nil, fmt.Errorf("signer name is required to issue a certificate through a CertificateSigningRequest")
+	}
+	if len(i.CACert) == 0 {
+		return nil, fmt.Errorf("the CA of the signer %s is required", i.SignerName)
+	}
+
+	opts := i.Options
+	if err := opts.setDefaults(); err != nil {
+		return nil, err
+	}
+
+	key, err := generateKey(opts.KeyType, opts.KeySize)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:     pkix.Name{CommonName: opts.CommonName, Organization: opts.Organizations},
+		DNSNames:    opts.DNSNames,
+		IPAddresses: opts.IPAddresses,
+	}, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the certificate request: %w", err)
+	}
+
+	usages := []certificatesv1.KeyUsage{certificatesv1.UsageDigitalSignature, certificatesv1.UsageServerAuth}
+	if opts.KeyType == KeyTypeRSA {
+		usages = append(usages, certificatesv1.UsageKeyEncipherment)
+	}
+	expirationSeconds := int32(opts.Validity / time.Second)
+
+	csrs := i.Client.CertificatesV1().CertificateSigningRequests()
+
+	// Every issuance creates a request of its own name, so replicas issuing at the same time never replace each
+	// other's requests
+	csr, err := csrs.Create(ctx, &certificatesv1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: i.Name + "-"},
+		Spec: certificatesv1.CertificateSigningRequestSpec{
+			Request:           pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: request}),
+			SignerName:        i.SignerName,
+			Usages:            usages,
+			ExpirationSeconds: &expirationSeconds,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the certificate signing request %s: %w", i.Name, err)
+	}
+	name := csr.Name
+	log.Printf("Created the certificate signing request %s for the signer %s", name, i.SignerName)
+
+	// The request is of no use once its certificate is read or the wait is over
+	defer func() {
+		if err := csrs.Delete(context.Background(), name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			log.Printf("Failed to delete the certificate signing request %s: %v", name, err)
+		}
+	}()
+
+	if i.AutoApprove {
+		csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
+			Type:           certificatesv1.CertificateApproved,
+			Status:         corev1.ConditionTrue,
+			Reason:         "AutoApproved",
+			Message:        "approved by the webhook server requesting its serving certificate",
+			LastUpdateTime: metav1.Now(),
+		})
+		if _, err = csrs.UpdateApproval(ctx, name, csr, metav1.UpdateOptions{}); err != nil {
+			return nil, fmt.Errorf("failed to approve the certificate signing request %s: %w", name, err)
+		}
+	}
+
+	certPEM, err := i.waitForCertificate(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	keyPEM, err := encodePrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Issued the certificate of the certificate signing request %s", name)
+	return &KeyPair{CACert: i.CACert, Cert: certPEM, Key: keyPEM.Bytes()}, nil
+}
+
+// waitForCertificate polls the request until the signer issued the certificate, or the request was denied or failed
+func (i *CSRIssuer) waitForCertificate(ctx context.Context, name string) ([]byte, error) {
+	interval, timeout := i.PollInterval, i.Timeout
+	if interval == 0 {
+		interval = DefaultCSRPollInterval
+	}
+	if timeout == 0 {
+		timeout = DefaultCSRTimeout
+	}
+
+	var certificate []byte
+	err := wait.PollUntilContextTimeout(ctx, interval, timeout, true, func(ctx context.Context) (bool, error) {
+		csr, err := i.Client.CertificatesV1().CertificateSigningRequests().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+
+		for _, condition := range csr.Status.Conditions {
+			switch condition.Type {
+			case certificatesv1.CertificateDenied, certificatesv1.CertificateFailed:
+				return false, fmt.Errorf("certificate signing request %s %s: %s", name, condition.Type, condition.Message)
+			}
+		}
+
+		certificate = csr.Status.Certificate
+		return len(certificate) > 0, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to wait for the certificate of %s: %w", name, err)
+	}
+
+	return certificate, nil
+}
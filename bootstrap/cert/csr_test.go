@@ -0,0 +1,203 @@
+package cert_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chungeun-choi/webhook/bootstrap/cert"
+	"github.com/stretchr/testify/assert"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// testSigner signs the certificate signing requests created through the client with its own CA
+type testSigner struct {
+	caCert *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	caPEM  []byte
+}
+
+func newTestSigner(t *testing.T) *testSigner {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-signer"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	caCert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	return &testSigner{
+		caCert: caCert,
+		caKey:  key,
+		caPEM:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// sign issues the certificate of the request as the signer of a cluster would
+func (s *testSigner) sign(t *testing.T, csr *certificatesv1.CertificateSigningRequest) {
+	block, _ := pem.Decode(csr.Spec.Request)
+	request, err := x509.ParseCertificateRequest(block.Bytes)
+	assert.NoError(t, err)
+
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      request.Subject,
+		DNSNames:     request.DNSNames,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Duration(*csr.Spec.ExpirationSeconds) * time.Second),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, s.caCert, request.PublicKey, s.caKey)
+	assert.NoError(t, err)
+
+	csr.Status.Certificate = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// createRequests completes the names of the created requests as the API server does and passes them to handle
+func createRequests(client *fake.Clientset, handle func(csr *certificatesv1.CertificateSigningRequest)) {
+	var mu sync.Mutex
+	created := 0
+	client.PrependReactor("create", "certificatesigningrequests", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		csr := action.(k8stesting.CreateAction).GetObject().(*certificatesv1.CertificateSigningRequest)
+
+		mu.Lock()
+		created++
+		csr.Name = csr.GenerateName + strconv.Itoa(created)
+		handle(csr)
+		mu.Unlock()
+
+		return false, nil, nil
+	})
+}
+
+func newCSRIssuer(client *fake.Clientset, caPEM []byte) *cert.CSRIssuer {
+	return &cert.CSRIssuer{
+		Client:     client,
+		Name:       "webhook.webhook-system",
+		SignerName: "example.com/webhook-serving",
+		Options: cert.Options{
+			CommonName: "webhook.webhook-system.svc",
+			DNSNames:   []string{"webhook.webhook-system.svc"},
+			KeyType:    cert.KeyTypeECDSA,
+			Validity:   24 * time.Hour,
+		},
+		CACert:       caPEM,
+		AutoApprove:  true,
+		PollInterval: 10 * time.Millisecond,
+		Timeout:      time.Second,
+	}
+}
+
+func TestCSRIssuerIssue(t *testing.T) {
+	signer := newTestSigner(t)
+	client := fake.NewSimpleClientset()
+	createRequests(client, func(csr *certificatesv1.CertificateSigningRequest) { signer.sign(t, csr) })
+
+	issuer := newCSRIssuer(client, signer.caPEM)
+	pair, err := issuer.Issue(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, signer.caPEM, pair.CACert)
+
+	// The key stays with the server and matches the issued certificate
+	_, err = tls.X509KeyPair(pair.Cert, pair.Key)
+	assert.NoError(t, err)
+
+	leaf, err := pair.Leaf()
+	assert.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(signer.caCert)
+	_, err = leaf.Verify(x509.VerifyOptions{
+		DNSName:   "webhook.webhook-system.svc",
+		Roots:     pool,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	assert.NoError(t, err)
+
+	var approved *certificatesv1.CertificateSigningRequest
+	for _, action := range client.Actions() {
+		if action.GetSubresource() == "approval" {
+			approved = action.(k8stesting.UpdateAction).GetObject().(*certificatesv1.CertificateSigningRequest)
+		}
+	}
+	if assert.NotNil(t, approved) {
+		assert.Equal(t, "webhook.webhook-system-1", approved.Name)
+		assert.Equal(t, "example.com/webhook-serving", approved.Spec.SignerName)
+		if assert.Len(t, approved.Status.Conditions, 1) {
+			assert.Equal(t, certificatesv1.CertificateApproved, approved.Status.Conditions[0].Type)
+		}
+	}
+
+	// The request is removed once its certificate is read
+	list, err := client.CertificatesV1().CertificateSigningRequests().List(context.TODO(), metav1.ListOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, list.Items)
+}
+
+// TestCSRIssuerReplicas tests that replicas issuing their certificates at the same time do not replace each
+// other's requests.
+func TestCSRIssuerReplicas(t *testing.T) {
+	signer := newTestSigner(t)
+	client := fake.NewSimpleClientset()
+
+	createRequests(client, func(csr *certificatesv1.CertificateSigningRequest) { signer.sign(t, csr) })
+
+	var wg sync.WaitGroup
+	pairs, errs := make([]*cert.KeyPair, 2), make([]error, 2)
+	for i := range pairs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			pairs[i], errs[i] = newCSRIssuer(client, signer.caPEM).Issue(context.TODO())
+		}(i)
+	}
+	wg.Wait()
+
+	// Every replica gets the certificate of its own key
+	for i := range pairs {
+		if assert.NoError(t, errs[i]) {
+			_, err := tls.X509KeyPair(pairs[i].Cert, pairs[i].Key)
+			assert.NoError(t, err)
+		}
+	}
+}
+
+func TestCSRIssuerDenied(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	createRequests(client, func(csr *certificatesv1.CertificateSigningRequest) {
+		csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
+			Type:    certificatesv1.CertificateDenied,
+			Status:  corev1.ConditionTrue,
+			Message: "signer does not allow the names",
+		})
+	})
+
+	issuer := newCSRIssuer(client, newTestSigner(t).caPEM)
+	issuer.AutoApprove = false
+
+	_, err := issuer.Issue(context.TODO())
+	assert.ErrorContains(t, err, "signer does not allow the names")
+}
@@ -2,133 +2,498 @@ package cert
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"errors"
+	"fmt"
 	"math/big"
+	"net"
 	"os"
+	"path/filepath"
 	"time"
 )
 
 const DefaultCertFilePath = "cert"
 
+// Key types of the generated certificates
+const (
+	KeyTypeRSA   = "rsa"
+	KeyTypeECDSA = "ecdsa"
+)
+
+const (
+	// DefaultRSAKeySize is the size in bits of generated RSA keys
+	DefaultRSAKeySize = 4096
+	// DefaultECDSAKeySize is the curve size of generated ECDSA keys
+	DefaultECDSAKeySize = 256
+	// DefaultValidity is how long generated certificates are valid
+	DefaultValidity = 365 * 24 * time.Hour
+	// DefaultCAValidityFactor is how many times longer than the certificate a generated CA is valid, so the
+	// renewals of the certificate reuse the CA and the CA bundle does not change with them
+	DefaultCAValidityFactor = 10
+)
+
 type CertPathInfo struct {
 	CaCertPath  string
+	CaKeyPath   string // empty when the key of the CA is not kept
 	CertPath    string
 	CertKeyPath string
 }
 
+// Options describe the CA and the serving certificate generated by Generate
+type Options struct {
+	Organizations []string
+	CommonName    string
+	DNSNames      []string
+	IPAddresses   []net.IP
+	KeyType       string        // KeyTypeRSA when empty
+	KeySize       int           // RSA bits or ECDSA curve size (256, 384 or 521), the default of the key type when zero
+	Validity      time.Duration // DefaultValidity when zero
+	CAValidity    time.Duration // DefaultCAValidityFactor times the validity when zero
+	Dir           string        // DefaultCertFilePath when empty
+}
+
+// GenerateCert generates a CA and a serving certificate for the DNS names with the default key type, validity
+// and directory
 func GenerateCert(orgs, dnsNames []string, commonName string) (*CertPathInfo, error) {
+	return Generate(Options{
+		Organizations: orgs,
+		CommonName:    commonName,
+		DNSNames:      dnsNames,
+	})
+}
+
+// KeyPair is a PEM encoded CA and serving certificate and key signed by it
+type KeyPair struct {
+	CACert []byte
+	CAKey  []byte // set when the CA was generated locally, so it can sign the renewed certificate
+	Cert   []byte
+	Key    []byte
+}
+
+// Generate generates a CA and a serving certificate signed by it, and writes ca.pem, cert.pem and key.pem to the
+// directory of the options
+func Generate(opts Options) (*CertPathInfo, error) {
+	pair, err := GenerateKeyPair(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return pair.WriteFiles(opts.Dir)
+}
+
+// GenerateKeyPair generates a CA and a serving certificate signed by it
+func GenerateKeyPair(opts Options) (*KeyPair, error) {
+	if err := opts.setDefaults(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
 	// init CA config
 	ca := &x509.Certificate{
-		SerialNumber:          big.NewInt(2022),
-		Subject:               pkix.Name{Organization: orgs},
-		NotBefore:             time.Now(),
-		NotAfter:              time.Now().AddDate(1, 0, 0), // expired in 1 year
+		Subject:               pkix.Name{Organization: opts.Organizations, CommonName: opts.CommonName + "-ca"},
+		NotBefore:             now.Add(-time.Minute), // tolerate clock skew
+		NotAfter:              now.Add(opts.CAValidity),
 		IsCA:                  true,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
 		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
 		BasicConstraintsValid: true,
 	}
 
 	// generate private key for CA
-	caPrivateKey, err := rsa.GenerateKey(rand.Reader, 4096)
+	caPrivateKey, err := generateKey(opts.KeyType, opts.KeySize)
 	if err != nil {
 		return nil, err
 	}
 
 	// create the CA certificate
-	caBytes, err := x509.CreateCertificate(rand.Reader, ca, ca, &caPrivateKey.PublicKey, caPrivateKey)
+	caBytes, err := createCertificate(ca, ca, caPrivateKey.Public(), caPrivateKey)
 	if err != nil {
 		return nil, err
 	}
 
-	// CA certificate with PEM encoded
-	caPEM := new(bytes.Buffer)
-	_ = pem.Encode(caPEM, &pem.Block{
-		Type:  "CERTIFICATE",
-		Bytes: caBytes,
-	})
+	caPrivateKeyPEM, err := encodePrivateKey(caPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	pair, err := signKeyPair(opts, ca, caPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	pair.CACert = encodeCertificate(caBytes).Bytes()
+	pair.CAKey = caPrivateKeyPEM.Bytes()
+
+	return pair, nil
+}
+
+// SignKeyPair generates a serving certificate signed by an existing CA given PEM encoded. The certificate does
+// not outlive the CA.
+func SignKeyPair(opts Options, caCertPEM, caKeyPEM []byte) (*KeyPair, error) {
+	if err := opts.setDefaults(); err != nil {
+		return nil, err
+	}
+
+	ca, err := parseCertificate(caCertPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the CA: %w", err)
+	}
+
+	caPrivateKey, err := parsePrivateKey(caKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the key of the CA: %w", err)
+	}
+
+	pair, err := signKeyPair(opts, ca, caPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	pair.CACert = caCertPEM
+	pair.CAKey = caKeyPEM
+
+	return pair, nil
+}
+
+// signKeyPair generates a serving certificate and key signed by the CA, without the CA in the returned pair
+func signKeyPair(opts Options, ca *x509.Certificate, caPrivateKey crypto.Signer) (*KeyPair, error) {
+	now := time.Now()
 
 	// new certificate config
 	newCert := &x509.Certificate{
-		DNSNames:     dnsNames,
-		SerialNumber: big.NewInt(1024),
+		DNSNames:    opts.DNSNames,
+		IPAddresses: opts.IPAddresses,
 		Subject: pkix.Name{
-			CommonName:   commonName,
-			Organization: orgs,
+			CommonName:   opts.CommonName,
+			Organization: opts.Organizations,
 		},
-		NotBefore:   time.Now(),
-		NotAfter:    time.Now().AddDate(1, 0, 0), // expired in 1 year
-		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		NotBefore:   now.Add(-time.Minute),
+		NotAfter:    now.Add(opts.Validity),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
 		KeyUsage:    x509.KeyUsageDigitalSignature,
 	}
+	if opts.KeyType == KeyTypeRSA {
+		newCert.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	if newCert.NotAfter.After(ca.NotAfter) {
+		newCert.NotAfter = ca.NotAfter
+	}
 
 	// generate new private key
-	newPrivateKey, err := rsa.GenerateKey(rand.Reader, 4096)
+	newPrivateKey, err := generateKey(opts.KeyType, opts.KeySize)
 	if err != nil {
 		return nil, err
 	}
 
 	// sign the new certificate
-	newCertBytes, err := x509.CreateCertificate(rand.Reader, newCert, ca, &newPrivateKey.PublicKey, caPrivateKey)
+	newCertBytes, err := createCertificate(newCert, ca, newPrivateKey.Public(), caPrivateKey)
 	if err != nil {
 		return nil, err
 	}
 
-	// new certificate with PEM encoded
-	newCertPEM := new(bytes.Buffer)
-	_ = pem.Encode(newCertPEM, &pem.Block{
-		Type:  "CERTIFICATE",
-		Bytes: newCertBytes,
-	})
+	newPrivateKeyPEM, err := encodePrivateKey(newPrivateKey)
+	if err != nil {
+		return nil, err
+	}
 
-	// new private key with PEM encoded
-	newPrivateKeyPEM := new(bytes.Buffer)
-	_ = pem.Encode(newPrivateKeyPEM, &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(newPrivateKey),
-	})
+	return &KeyPair{
+		Cert: encodeCertificate(newCertBytes).Bytes(),
+		Key:  newPrivateKeyPEM.Bytes(),
+	}, nil
+}
 
-	// 파일로 저장하는 기능 추가
-	err = saveToFile(DefaultCertFilePath+"/ca.pem", caPEM)
-	if err != nil {
+// WriteFiles writes ca.pem, cert.pem and key.pem, and ca-key.pem when the pair has the key of the CA, to the
+// directory, DefaultCertFilePath when empty
+func (p *KeyPair) WriteFiles(dir string) (*CertPathInfo, error) {
+	info := PathInfo(dir)
+	if len(p.CAKey) == 0 {
+		info.CaKeyPath = ""
+	}
+
+	return info, p.Write(info)
+}
+
+// Write writes the pair to the paths. The key of the CA is written only when both the pair and the paths have it.
+func (p *KeyPair) Write(info *CertPathInfo) error {
+	// The key pair is written before the CA, so the CA bundle never points at a CA the served certificate is not
+	// signed by for longer than needed
+	if err := saveToFile(info.CertKeyPath, bytes.NewBuffer(p.Key), 0600); err != nil {
+		return err
+	}
+
+	if err := saveToFile(info.CertPath, bytes.NewBuffer(p.Cert), 0644); err != nil {
+		return err
+	}
+
+	if len(p.CAKey) > 0 && info.CaKeyPath != "" {
+		if err := saveToFile(info.CaKeyPath, bytes.NewBuffer(p.CAKey), 0600); err != nil {
+			return err
+		}
+	}
+
+	if info.CaCertPath != "" {
+		if err := saveToFile(info.CaCertPath, bytes.NewBuffer(p.CACert), 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReadKeyPair reads the pair from the paths. The CA and its key are optional and left empty when their path is
+// empty or the file does not exist.
+func ReadKeyPair(info *CertPathInfo) (*KeyPair, error) {
+	pair := &KeyPair{}
+
+	var err error
+	if pair.Cert, err = os.ReadFile(info.CertPath); err != nil {
+		return nil, err
+	}
+	if pair.Key, err = os.ReadFile(info.CertKeyPath); err != nil {
 		return nil, err
 	}
+	if pair.CACert, err = readOptionalFile(info.CaCertPath); err != nil {
+		return nil, err
+	}
+	if pair.CAKey, err = readOptionalFile(info.CaKeyPath); err != nil {
+		return nil, err
+	}
+
+	return pair, nil
+}
+
+// readOptionalFile reads the file, returning no content when the path is empty or the file does not exist
+func readOptionalFile(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	return data, err
+}
+
+// PathInfo returns the paths of ca.pem, ca-key.pem, cert.pem and key.pem in the directory, DefaultCertFilePath
+// when empty
+func PathInfo(dir string) *CertPathInfo {
+	if dir == "" {
+		dir = DefaultCertFilePath
+	}
+
+	return &CertPathInfo{
+		CaCertPath:  filepath.Join(dir, "ca.pem"),
+		CaKeyPath:   filepath.Join(dir, "ca-key.pem"),
+		CertPath:    filepath.Join(dir, "cert.pem"),
+		CertKeyPath: filepath.Join(dir, "key.pem"),
+	}
+}
+
+// Leaf returns the parsed serving certificate of the pair
+func (p *KeyPair) Leaf() (*x509.Certificate, error) {
+	return parseCertificate(p.Cert)
+}
 
-	err = saveToFile(DefaultCertFilePath+"/cert.pem", newCertPEM)
+// CA returns the parsed CA of the pair
+func (p *KeyPair) CA() (*x509.Certificate, error) {
+	return parseCertificate(p.CACert)
+}
+
+// caBundle returns the PEM encoded certificates of the bundles in order, without those that expired
+func caBundle(bundles ...[]byte) []byte {
+	now := time.Now()
+
+	buf := new(bytes.Buffer)
+	for _, rest := range bundles {
+		for {
+			var block *pem.Block
+			if block, rest = pem.Decode(rest); block == nil {
+				break
+			}
+
+			certificate, err := x509.ParseCertificate(block.Bytes)
+			if err != nil || now.After(certificate.NotAfter) {
+				continue
+			}
+			_ = pem.Encode(buf, block)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// parseCertificate parses the first PEM encoded certificate
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("failed to decode the certificate PEM")
+	}
+
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// setDefaults fills the unset options and checks the key type and size
+func (opts *Options) setDefaults() error {
+	if opts.KeyType == "" {
+		opts.KeyType = KeyTypeRSA
+	}
+
+	switch opts.KeyType {
+	case KeyTypeRSA:
+		if opts.KeySize == 0 {
+			opts.KeySize = DefaultRSAKeySize
+		}
+		if opts.KeySize < 2048 {
+			return fmt.Errorf("RSA key size must be at least 2048 bits, not %d", opts.KeySize)
+		}
+	case KeyTypeECDSA:
+		if opts.KeySize == 0 {
+			opts.KeySize = DefaultECDSAKeySize
+		}
+		if _, err := curveOf(opts.KeySize); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported key type %q, must be %s or %s", opts.KeyType, KeyTypeRSA, KeyTypeECDSA)
+	}
+
+	if opts.Validity == 0 {
+		opts.Validity = DefaultValidity
+	}
+	if opts.Validity < 0 {
+		return fmt.Errorf("validity must be positive, not %s", opts.Validity)
+	}
+	if opts.CAValidity == 0 {
+		opts.CAValidity = DefaultCAValidityFactor * opts.Validity
+	}
+	if opts.CAValidity < opts.Validity {
+		return fmt.Errorf("CA validity %s must not be shorter than the validity %s", opts.CAValidity, opts.Validity)
+	}
+
+	if opts.Dir == "" {
+		opts.Dir = DefaultCertFilePath
+	}
+
+	if len(opts.DNSNames) == 0 && len(opts.IPAddresses) == 0 {
+		return fmt.Errorf("at least one DNS name or IP address is required")
+	}
+
+	return nil
+}
+
+// generateKey generates a private key of the type and size
+func generateKey(keyType string, keySize int) (crypto.Signer, error) {
+	if keyType == KeyTypeECDSA {
+		curve, err := curveOf(keySize)
+		if err != nil {
+			return nil, err
+		}
+		return ecdsa.GenerateKey(curve, rand.Reader)
+	}
+
+	return rsa.GenerateKey(rand.Reader, keySize)
+}
+
+// curveOf returns the elliptic curve of the size
+func curveOf(keySize int) (elliptic.Curve, error) {
+	switch keySize {
+	case 256:
+		return elliptic.P256(), nil
+	case 384:
+		return elliptic.P384(), nil
+	case 521:
+		return elliptic.P521(), nil
+	default:
+		return nil, fmt.Errorf("ECDSA key size must be 256, 384 or 521, not %d", keySize)
+	}
+}
+
+// createCertificate signs the template with a random serial number
+func createCertificate(template, parent *x509.Certificate, pub crypto.PublicKey, priv crypto.Signer) ([]byte, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
 	if err != nil {
 		return nil, err
 	}
+	template.SerialNumber = serialNumber
+
+	return x509.CreateCertificate(rand.Reader, template, parent, pub, priv)
+}
+
+// encodeCertificate returns the certificate PEM encoded
+func encodeCertificate(der []byte) *bytes.Buffer {
+	buf := new(bytes.Buffer)
+	_ = pem.Encode(buf, &pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: der,
+	})
+
+	return buf
+}
+
+// encodePrivateKey returns the private key PEM encoded
+func encodePrivateKey(key crypto.Signer) (*bytes.Buffer, error) {
+	block := &pem.Block{}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		block.Type = "RSA PRIVATE KEY"
+		block.Bytes = x509.MarshalPKCS1PrivateKey(k)
+	case *ecdsa.PrivateKey:
+		der, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return nil, err
+		}
+		block.Type = "EC PRIVATE KEY"
+		block.Bytes = der
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+
+	buf := new(bytes.Buffer)
+	_ = pem.Encode(buf, block)
+
+	return buf, nil
+}
+
+// parsePrivateKey parses a PEM encoded PKCS #1, SEC 1 or PKCS #8 private key
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode the private key PEM")
+	}
 
-	err = saveToFile(DefaultCertFilePath+"/key.pem", newPrivateKeyPEM)
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
 	if err != nil {
 		return nil, err
 	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
 
-	return &CertPathInfo{
-		CaCertPath:  DefaultCertFilePath + "/ca.pem",
-		CertPath:    DefaultCertFilePath + "/cert.pem",
-		CertKeyPath: DefaultCertFilePath + "/key.pem",
-	}, nil
+	return signer, nil
 }
 
-func saveToFile(filename string, data *bytes.Buffer) error {
+func saveToFile(filename string, data *bytes.Buffer, perm os.FileMode) error {
 	// 디렉토리가 존재하지 않으면 생성
-	err := os.MkdirAll("cert", 0755)
+	err := os.MkdirAll(filepath.Dir(filename), 0755)
 	if err != nil {
 		return err
 	}
 
 	// 파일 생성 및 데이터 저장
-	file, err := os.Create(filename)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	_, err = file.Write(data.Bytes())
-	return err
+	return os.WriteFile(filename, data.Bytes(), perm)
 }
@@ -0,0 +1,62 @@
+package cert
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Issuer issues the CA and serving certificate used by the server
+type Issuer interface {
+	Issue(ctx context.Context) (*KeyPair, error)
+}
+
+// Renewer is an Issuer that renews a key pair it issued before by reusing what does not need renewal yet
+type Renewer interface {
+	Issuer
+	Renew(ctx context.Context, current *KeyPair, renewBefore time.Duration) (*KeyPair, error)
+}
+
+// SelfSignedIssuer issues a serving certificate signed by a newly generated CA
+type SelfSignedIssuer struct {
+	Options Options
+}
+
+// Issue generates a new CA and a serving certificate signed by it
+func (i *SelfSignedIssuer) Issue(context.Context) (*KeyPair, error) {
+	return GenerateKeyPair(i.Options)
+}
+
+// Renew signs a new serving certificate with the current CA while the CA is valid for longer than renewBefore and
+// than the validity of the certificate, so the CA bundle of the webhook configurations stays the same. A new CA is
+// generated otherwise, or when the key
+// of the current CA is not known, and published in the bundle with the current CA until that one expires, so the
+// API server trusts the certificate of a server that has not reloaded yet as well as the renewed one.
+func (i *SelfSignedIssuer) Renew(ctx context.Context, current *KeyPair, renewBefore time.Duration) (*KeyPair, error) {
+	if current == nil {
+		return i.Issue(ctx)
+	}
+
+	validity := i.Options.Validity
+	if validity == 0 {
+		validity = DefaultValidity
+	}
+
+	if ca, err := current.CA(); err == nil && len(current.CAKey) > 0 && time.Until(ca.NotAfter) > max(renewBefore, validity) {
+		pair, err := SignKeyPair(i.Options, current.CACert, current.CAKey)
+		if err == nil {
+			// A CA kept in the bundle by a previous rotation is dropped once it expired
+			pair.CACert = caBundle(current.CACert)
+			return pair, nil
+		}
+		log.Printf("Failed to sign the certificate with the current CA, generating a new CA: %v", err)
+	}
+
+	pair, err := i.Issue(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pair.CACert = caBundle(pair.CACert, current.CACert)
+
+	return pair, nil
+}
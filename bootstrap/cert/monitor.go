@@ -0,0 +1,211 @@
+package cert
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRenewWindow is how long before it expires a certificate is renewed
+	DefaultRenewWindow = 30 * 24 * time.Hour
+	// DefaultMonitorInterval is how often the expiry of the certificates is checked
+	DefaultMonitorInterval = time.Hour
+)
+
+// CertificateStatus is the validity of a certificate
+type CertificateStatus struct {
+	Subject      string    `json:"subject"`
+	NotBefore    time.Time `json:"notBefore"`
+	NotAfter     time.Time `json:"notAfter"`
+	DaysToExpiry int       `json:"daysToExpiry"` // whole days left, negative once expired
+	Expired      bool      `json:"expired"`
+	Renew        bool      `json:"renew"` // the certificate is within the renewal window
+}
+
+// Status is the outcome of the last expiry check of the monitor
+type Status struct {
+	CA          *CertificateStatus `json:"ca,omitempty"` // nil when the CA is unknown
+	Certificate *CertificateStatus `json:"certificate,omitempty"`
+	RenewWindow string             `json:"renewWindow"`
+	AutoRenew   bool               `json:"autoRenew"`
+	CheckedAt   time.Time          `json:"checkedAt"`
+	RenewedAt   *time.Time         `json:"renewedAt,omitempty"`
+	Error       string             `json:"error,omitempty"`
+}
+
+// ExpiryMonitor checks the expiry of the serving certificate and its CA in the files, and renews them through the
+// issuer once either one is within the renewal window. Without an issuer, e.g. for certificates provided by the
+// user or renewed by a SecretStore, the monitor only reports and warns.
+type ExpiryMonitor struct {
+	Paths       *CertPathInfo
+	Issuer      Issuer        // renews the key pair, a Renewer renews it by reusing the CA; nil disables the renewal
+	RenewWindow time.Duration // DefaultRenewWindow when zero
+
+	checkMu sync.Mutex   // serializes the checks, so a renewal is not issued twice
+	mu      sync.RWMutex // guards status only, so the status is readable while a renewal is issued
+	status  Status
+}
+
+// Status returns the outcome of the last check
+func (m *ExpiryMonitor) Status() Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.status
+}
+
+// Check reads the certificates, renews them when they are within the renewal window and records the status
+func (m *ExpiryMonitor) Check(ctx context.Context) (Status, error) {
+	m.checkMu.Lock()
+	defer m.checkMu.Unlock()
+
+	status := Status{
+		RenewWindow: m.renewWindow().String(),
+		AutoRenew:   m.Issuer != nil,
+		CheckedAt:   time.Now(),
+		RenewedAt:   m.Status().RenewedAt,
+	}
+
+	pair, err := m.check(&status)
+	if err == nil && m.Issuer != nil && needsRenewal(&status) {
+		if err = m.renew(ctx, pair); err == nil {
+			renewedAt := time.Now()
+			status.RenewedAt = &renewedAt
+			_, err = m.check(&status)
+		}
+	}
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	m.mu.Lock()
+	m.status = status
+	m.mu.Unlock()
+
+	return status, err
+}
+
+// Run checks the certificates at the interval until the context is done
+func (m *ExpiryMonitor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := m.Check(ctx); err != nil {
+			log.Printf("Failed to check the expiry of the certificate: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check reads the key pair in the files and fills the status of its certificates
+func (m *ExpiryMonitor) check(status *Status) (*KeyPair, error) {
+	pair, err := ReadKeyPair(m.Paths)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the certificate: %w", err)
+	}
+
+	leaf, err := pair.Leaf()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the certificate %s: %w", m.Paths.CertPath, err)
+	}
+	status.Certificate = m.certificateStatus(leaf)
+
+	status.CA = nil
+	if len(pair.CACert) > 0 {
+		ca, err := pair.CA()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the CA %s: %w", m.Paths.CaCertPath, err)
+		}
+		status.CA = m.certificateStatus(ca)
+	}
+
+	if !status.AutoRenew {
+		warnExpiry("certificate", status.Certificate)
+		warnExpiry("CA", status.CA)
+	}
+
+	return pair, nil
+}
+
+// renew issues a new key pair and writes it to the files
+func (m *ExpiryMonitor) renew(ctx context.Context, current *KeyPair) error {
+	var (
+		pair *KeyPair
+		err  error
+	)
+	if renewer, ok := m.Issuer.(Renewer); ok {
+		pair, err = renewer.Renew(ctx, current, m.renewWindow())
+	} else {
+		pair, err = m.Issuer.Issue(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to renew the certificate: %w", err)
+	}
+
+	// The renewed pair must be usable before it replaces the pair being served
+	if _, err = tls.X509KeyPair(pair.Cert, pair.Key); err != nil {
+		return fmt.Errorf("renewed certificate is invalid: %w", err)
+	}
+
+	if err = pair.Write(m.Paths); err != nil {
+		return fmt.Errorf("failed to write the renewed certificate: %w", err)
+	}
+
+	if len(current.CACert) > 0 && bytes.Equal(current.CACert, pair.CACert) {
+		log.Printf("Renewed the certificate %s with the current CA", m.Paths.CertPath)
+	} else {
+		log.Printf("Renewed the certificate %s and its CA %s", m.Paths.CertPath, m.Paths.CaCertPath)
+	}
+
+	return nil
+}
+
+// certificateStatus returns the validity of the certificate
+func (m *ExpiryMonitor) certificateStatus(certificate *x509.Certificate) *CertificateStatus {
+	left := time.Until(certificate.NotAfter)
+
+	return &CertificateStatus{
+		Subject:      certificate.Subject.CommonName,
+		NotBefore:    certificate.NotBefore,
+		NotAfter:     certificate.NotAfter,
+		DaysToExpiry: int(math.Floor(left.Hours() / 24)),
+		Expired:      left <= 0,
+		Renew:        left <= m.renewWindow(),
+	}
+}
+
+func (m *ExpiryMonitor) renewWindow() time.Duration {
+	if m.RenewWindow == 0 {
+		return DefaultRenewWindow
+	}
+
+	return m.RenewWindow
+}
+
+// needsRenewal reports whether the certificate or the CA is within the renewal window
+func needsRenewal(status *Status) bool {
+	return status.Certificate.Renew || (status.CA != nil && status.CA.Renew)
+}
+
+// warnExpiry logs a certificate within the renewal window that is not renewed automatically
+func warnExpiry(name string, status *CertificateStatus) {
+	if status == nil || !status.Renew {
+		return
+	}
+
+	log.Printf("The %s %s expires in %d days on %s and is not renewed automatically", name, status.Subject,
+		status.DaysToExpiry, status.NotAfter.Format(time.RFC3339))
+}
@@ -0,0 +1,169 @@
+package cert_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/chungeun-choi/webhook/bootstrap/cert"
+	"github.com/stretchr/testify/assert"
+)
+
+func monitorOptions(validity time.Duration) cert.Options {
+	return cert.Options{
+		CommonName: "webhook.webhook-system.svc",
+		DNSNames:   []string{"webhook.webhook-system.svc"},
+		KeyType:    cert.KeyTypeECDSA,
+		Validity:   validity,
+	}
+}
+
+// caOptions returns the options of a CA valid for the validity
+func caOptions(validity time.Duration) cert.Options {
+	opts := monitorOptions(validity)
+	opts.CAValidity = validity
+	return opts
+}
+
+// writeShortLived writes a certificate valid for an hour signed by a CA valid for caValidity
+func writeShortLived(t *testing.T, caValidity time.Duration) (*cert.CertPathInfo, *cert.KeyPair) {
+	ca, err := cert.GenerateKeyPair(caOptions(caValidity))
+	assert.NoError(t, err)
+
+	pair, err := cert.SignKeyPair(monitorOptions(time.Hour), ca.CACert, ca.CAKey)
+	assert.NoError(t, err)
+
+	info, err := pair.WriteFiles(t.TempDir())
+	assert.NoError(t, err)
+
+	return info, pair
+}
+
+// blockingIssuer issues a key pair once released, as an issuer waiting for a signer would
+type blockingIssuer struct {
+	started, release chan struct{}
+}
+
+func (i *blockingIssuer) Issue(ctx context.Context) (*cert.KeyPair, error) {
+	close(i.started)
+	<-i.release
+	return cert.GenerateKeyPair(monitorOptions(90 * 24 * time.Hour))
+}
+
+func TestExpiryMonitorStatusDuringRenewal(t *testing.T) {
+	info, _ := writeShortLived(t, 365*24*time.Hour)
+	issuer := &blockingIssuer{started: make(chan struct{}), release: make(chan struct{})}
+	monitor := &cert.ExpiryMonitor{Paths: info, Issuer: issuer, RenewWindow: 24 * time.Hour}
+
+	done := make(chan error)
+	go func() {
+		_, err := monitor.Check(context.TODO())
+		done <- err
+	}()
+	<-issuer.started
+
+	// The status of the previous check is readable while the renewal is issued
+	status := make(chan cert.Status)
+	go func() { status <- monitor.Status() }()
+	select {
+	case current := <-status:
+		assert.Nil(t, current.RenewedAt)
+	case <-time.After(time.Second):
+		t.Fatal("Status blocked during the renewal")
+	}
+
+	close(issuer.release)
+	assert.NoError(t, <-done)
+	assert.NotNil(t, monitor.Status().RenewedAt)
+}
+
+func TestExpiryMonitorReusesCA(t *testing.T) {
+	info, current := writeShortLived(t, 365*24*time.Hour)
+
+	monitor := &cert.ExpiryMonitor{
+		Paths:       info,
+		Issuer:      &cert.SelfSignedIssuer{Options: monitorOptions(90 * 24 * time.Hour)},
+		RenewWindow: 24 * time.Hour,
+	}
+
+	status, err := monitor.Check(context.TODO())
+	assert.NoError(t, err)
+	assert.NotNil(t, status.RenewedAt)
+	assert.False(t, status.Certificate.Renew)
+	assert.Equal(t, 89, status.Certificate.DaysToExpiry)
+	assert.Equal(t, 364, status.CA.DaysToExpiry)
+
+	// The CA bundle does not change, only the serving certificate does
+	renewed, err := cert.ReadKeyPair(info)
+	assert.NoError(t, err)
+	assert.Equal(t, current.CACert, renewed.CACert)
+	assert.Equal(t, current.CAKey, renewed.CAKey)
+	assert.NotEqual(t, current.Cert, renewed.Cert)
+	assert.Equal(t, status, monitor.Status())
+}
+
+func TestExpiryMonitorRenewsExpiringCA(t *testing.T) {
+	info, current := writeShortLived(t, 2*time.Hour)
+
+	monitor := &cert.ExpiryMonitor{
+		Paths:       info,
+		Issuer:      &cert.SelfSignedIssuer{Options: monitorOptions(90 * 24 * time.Hour)},
+		RenewWindow: 24 * time.Hour,
+	}
+
+	status, err := monitor.Check(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 899, status.CA.DaysToExpiry)
+
+	// The new CA is published with the current one until it expires
+	renewed, err := cert.ReadKeyPair(info)
+	assert.NoError(t, err)
+	assert.NotEqual(t, current.CACert, renewed.CACert)
+	assert.Contains(t, string(renewed.CACert), string(current.CACert))
+
+	leaf, err := renewed.Leaf()
+	assert.NoError(t, err)
+	ca, err := renewed.CA()
+	assert.NoError(t, err)
+	assert.NoError(t, leaf.CheckSignatureFrom(ca))
+}
+
+func TestExpiryMonitorReportOnly(t *testing.T) {
+	info, current := writeShortLived(t, 365*24*time.Hour)
+	info.CaKeyPath = ""
+
+	monitor := &cert.ExpiryMonitor{Paths: info}
+
+	status, err := monitor.Check(context.TODO())
+	assert.NoError(t, err)
+	assert.False(t, status.AutoRenew)
+	assert.Nil(t, status.RenewedAt)
+	assert.True(t, status.Certificate.Renew)
+	assert.Equal(t, 0, status.Certificate.DaysToExpiry)
+	assert.False(t, status.CA.Renew)
+
+	data, err := os.ReadFile(info.CertPath)
+	assert.NoError(t, err)
+	assert.Equal(t, current.Cert, data)
+}
+
+// TestSelfSignedIssuerRenew tests that the renewals of a generated key pair reuse its CA.
+func TestSelfSignedIssuerRenew(t *testing.T) {
+	issuer := &cert.SelfSignedIssuer{Options: monitorOptions(90 * 24 * time.Hour)}
+	current, err := issuer.Issue(context.TODO())
+	assert.NoError(t, err)
+
+	renewed, err := issuer.Renew(context.TODO(), current, 30*24*time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, current.CACert, renewed.CACert)
+	assert.Equal(t, current.CAKey, renewed.CAKey)
+	assert.NotEqual(t, current.Cert, renewed.Cert)
+
+	leaf, err := renewed.Leaf()
+	assert.NoError(t, err)
+	ca, err := renewed.CA()
+	assert.NoError(t, err)
+	assert.NoError(t, leaf.CheckSignatureFrom(ca))
+	assert.WithinDuration(t, time.Now().Add(90*24*time.Hour), leaf.NotAfter, 2*time.Minute)
+}
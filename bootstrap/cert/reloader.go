@@ -0,0 +1,142 @@
+package cert
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultReloadInterval is how often the certificate and key files are checked for changes
+const DefaultReloadInterval = 10 * time.Second
+
+// KeyPairReloader serves a certificate and key pair from files and reloads it when the files change, so a
+// rotated certificate is served without restarting the server. A new pair that cannot be loaded is rejected and
+// the previous pair keeps being served.
+type KeyPairReloader struct {
+	certFile string
+	keyFile  string
+
+	cert atomic.Pointer[tls.Certificate]
+
+	mu         sync.Mutex // serializes reloads and guards the digests
+	certDigest [sha256.Size]byte
+	keyDigest  [sha256.Size]byte
+}
+
+// NewKeyPairReloader loads the key pair from the files
+func NewKeyPairReloader(certFile, keyFile string) (*KeyPairReloader, error) {
+	r := &KeyPairReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// GetCertificate returns the current key pair, it is meant for tls.Config.GetCertificate
+func (r *KeyPairReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+// Certificate returns the parsed leaf certificate of the current key pair
+func (r *KeyPairReloader) Certificate() *x509.Certificate {
+	return r.cert.Load().Leaf
+}
+
+// Reload loads the key pair from the files and swaps it in. The current pair is kept if the new one is invalid.
+func (r *KeyPairReloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	certPEM, keyPEM, err := r.read()
+	if err != nil {
+		return err
+	}
+	// The digests are recorded even if the pair is invalid, so it is only tried again once the content changes. A
+	// file read while it is being written is tried again when the write completes, whatever its modification time.
+	r.certDigest, r.keyDigest = sha256.Sum256(certPEM), sha256.Sum256(keyPEM)
+
+	return r.load(certPEM, keyPEM)
+}
+
+// Run checks the files for changes at the interval and reloads the key pair until the context is done
+func (r *KeyPairReloader) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				log.Printf("Failed to reload the certificate, serving the previous certificate: %v", err)
+			}
+		}
+	}
+}
+
+// changed reports whether the content of the certificate or key file changed since the last reload
+func (r *KeyPairReloader) changed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	certPEM, keyPEM, err := r.read()
+	if err != nil {
+		log.Printf("Failed to check the certificate files: %v", err)
+		return false
+	}
+
+	return sha256.Sum256(certPEM) != r.certDigest || sha256.Sum256(keyPEM) != r.keyDigest
+}
+
+// read returns the content of the certificate and key files
+func (r *KeyPairReloader) read() ([]byte, []byte, error) {
+	certPEM, err := os.ReadFile(r.certFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyPEM, err := os.ReadFile(r.keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return certPEM, keyPEM, nil
+}
+
+// load parses and validates the key pair read from the files and swaps it in. The caller must hold the lock.
+func (r *KeyPairReloader) load(certPEM, keyPEM []byte) error {
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("invalid key pair %s, %s: %w", r.certFile, r.keyFile, err)
+	}
+
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("invalid certificate %s: %w", r.certFile, err)
+	}
+	if time.Now().After(leaf.NotAfter) {
+		// An expired certificate never replaces the current one, but is served rather than none at startup
+		if r.cert.Load() != nil {
+			return fmt.Errorf("certificate %s expired at %s", r.certFile, leaf.NotAfter.Format(time.RFC3339))
+		}
+		log.Printf("Warning: the certificate %s expired at %s", r.certFile, leaf.NotAfter.Format(time.RFC3339))
+	}
+	pair.Leaf = leaf
+
+	r.cert.Store(&pair)
+	log.Printf("Loaded the certificate %s (%s), expires at %s", r.certFile, leaf.Subject.CommonName, leaf.NotAfter.Format(time.RFC3339))
+
+	return nil
+}
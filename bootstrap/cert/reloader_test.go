@@ -0,0 +1,91 @@
+package cert_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chungeun-choi/webhook/bootstrap/cert"
+	"github.com/stretchr/testify/assert"
+)
+
+// generate writes a key pair for the DNS name into the directory
+func generate(t *testing.T, dir, dnsName string) *cert.CertPathInfo {
+	info, err := cert.Generate(cert.Options{DNSNames: []string{dnsName}, CommonName: dnsName, KeyType: cert.KeyTypeECDSA, Dir: dir})
+	assert.NoError(t, err)
+
+	return info
+}
+
+// copyFile replaces the destination with the source and sets its modification time
+func copyFile(t *testing.T, src, dst string, modTime time.Time) {
+	data, err := os.ReadFile(src)
+	assert.NoError(t, err)
+	writeFile(t, dst, data, modTime)
+}
+
+// writeFile replaces the file with the data and sets its modification time
+func writeFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	assert.NoError(t, os.WriteFile(path, data, 0600))
+	assert.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestKeyPairReloader(t *testing.T) {
+	dir := t.TempDir()
+	current := generate(t, dir, "first.example.com")
+
+	reloader, err := cert.NewKeyPairReloader(current.CertPath, current.CertKeyPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "first.example.com", reloader.Certificate().Subject.CommonName)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.Run(ctx, 10*time.Millisecond)
+
+	// A rotated pair is picked up by the watcher
+	rotated := generate(t, filepath.Join(dir, "rotated"), "second.example.com")
+	modTime := time.Now().Add(time.Minute)
+	copyFile(t, rotated.CertPath, current.CertPath, modTime)
+	copyFile(t, rotated.CertKeyPath, current.CertKeyPath, modTime)
+
+	assert.Eventually(t, func() bool {
+		pair, err := reloader.GetCertificate(nil)
+		return err == nil && pair.Leaf.Subject.CommonName == "second.example.com"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// A certificate that does not match the key is rejected and the previous pair is still served
+	other := generate(t, filepath.Join(dir, "other"), "third.example.com")
+	copyFile(t, other.CertPath, current.CertPath, modTime.Add(time.Minute))
+
+	assert.Error(t, reloader.Reload())
+	assert.Equal(t, "second.example.com", reloader.Certificate().Subject.CommonName)
+}
+
+func TestKeyPairReloaderPartialWrite(t *testing.T) {
+	dir := t.TempDir()
+	current := generate(t, dir, "first.example.com")
+	rotated := generate(t, filepath.Join(dir, "rotated"), "second.example.com")
+
+	reloader, err := cert.NewKeyPairReloader(current.CertPath, current.CertKeyPath)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.Run(ctx, 10*time.Millisecond)
+
+	// The rotated files are read while half written, and completed within the same modification time
+	certPEM, err := os.ReadFile(rotated.CertPath)
+	assert.NoError(t, err)
+	modTime := time.Now().Add(time.Minute)
+	copyFile(t, rotated.CertKeyPath, current.CertKeyPath, modTime)
+	writeFile(t, current.CertPath, certPEM[:len(certPEM)/2], modTime)
+	assert.Error(t, reloader.Reload())
+	assert.Equal(t, "first.example.com", reloader.Certificate().Subject.CommonName)
+
+	writeFile(t, current.CertPath, certPEM, modTime)
+	assert.Eventually(t, func() bool {
+		return reloader.Certificate().Subject.CommonName == "second.example.com"
+	}, 5*time.Second, 10*time.Millisecond)
+}
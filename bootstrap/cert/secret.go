@@ -0,0 +1,239 @@
+package cert
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DefaultSecretSyncInterval is how often the Secret is checked for a renewed or expiring certificate
+const DefaultSecretSyncInterval = time.Minute
+
+// DefaultRenewBefore is how long before its expiry a certificate stored in a Secret is renewed
+const DefaultRenewBefore = 30 * 24 * time.Hour
+
+// CAKeySecretKey is the key of the Secret holding the key of a self-signed CA, so any replica can sign the renewed
+// certificate with the same CA
+const CAKeySecretKey = "ca.key"
+
+// SecretStore keeps the CA and serving certificate in a TLS Secret shared by every replica of the server. The
+// first replica issues the key pair into the Secret, the others load it from there, and whichever replica
+// notices that the certificate or the CA is about to expire renews it. The key of a self-signed CA is kept in the
+// Secret as well, so the certificate is renewed with the same CA while the CA is valid.
+type SecretStore struct {
+	Client      kubernetes.Interface
+	Namespace   string
+	Name        string
+	Options     Options       // options of the generated key pairs
+	Issuer      Issuer        // issues the key pairs, a Renewer renews them; a SelfSignedIssuer with the options when nil
+	RenewBefore time.Duration // DefaultRenewBefore when zero
+}
+
+// Ensure returns the key pair of the Secret, creating the Secret or renewing the key pair when needed. A replica
+// losing the race to create or renew the Secret loads the key pair written by the winner. The key of the CA is not
+// returned, it only lives in the Secret.
+func (s *SecretStore) Ensure(ctx context.Context) (*KeyPair, error) {
+	pair, err := s.ensure(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pair.CAKey = nil
+	return pair, nil
+}
+
+// ensure returns the key pair of the Secret with the key of the CA
+func (s *SecretStore) ensure(ctx context.Context) (*KeyPair, error) {
+	secrets := s.Client.CoreV1().Secrets(s.Namespace)
+
+	secret, err := secrets.Get(ctx, s.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return s.create(ctx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the certificate secret %s/%s: %w", s.Namespace, s.Name, err)
+	}
+
+	pair := keyPairOf(secret)
+	if !s.needsRenewal(pair) {
+		return pair, nil
+	}
+
+	return s.renew(ctx, secret)
+}
+
+// issuer returns the issuer of the key pairs
+func (s *SecretStore) issuer() Issuer {
+	if s.Issuer == nil {
+		return &SelfSignedIssuer{Options: s.Options}
+	}
+
+	return s.Issuer
+}
+
+// create issues a key pair into a new Secret
+func (s *SecretStore) create(ctx context.Context) (*KeyPair, error) {
+	pair, err := s.issuer().Issue(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: s.Name, Namespace: s.Namespace},
+		Type:       corev1.SecretTypeTLS,
+		Data:       secretData(pair),
+	}
+
+	_, err = s.Client.CoreV1().Secrets(s.Namespace).Create(ctx, secret, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		// Another replica created the Secret first
+		return s.load(ctx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the certificate secret %s/%s: %w", s.Namespace, s.Name, err)
+	}
+
+	log.Printf("Issued the certificate into the secret %s/%s", s.Namespace, s.Name)
+	return pair, nil
+}
+
+// renew issues a new key pair into the Secret, reusing the CA of the Secret while it is valid when the issuer is
+// a Renewer
+func (s *SecretStore) renew(ctx context.Context, secret *corev1.Secret) (*KeyPair, error) {
+	var (
+		issuer = s.issuer()
+		pair   *KeyPair
+		err    error
+	)
+	if renewer, ok := issuer.(Renewer); ok {
+		pair, err = renewer.Renew(ctx, keyPairOf(secret), s.renewBefore())
+	} else {
+		pair, err = issuer.Issue(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	secret = secret.DeepCopy()
+	secret.Data = secretData(pair)
+
+	// The update is conditional on the resource version, so only one replica renews the certificate
+	_, err = s.Client.CoreV1().Secrets(s.Namespace).Update(ctx, secret, metav1.UpdateOptions{})
+	if apierrors.IsConflict(err) {
+		return s.load(ctx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to renew the certificate secret %s/%s: %w", s.Namespace, s.Name, err)
+	}
+
+	log.Printf("Renewed the certificate of the secret %s/%s", s.Namespace, s.Name)
+	return pair, nil
+}
+
+// load returns the key pair of the Secret
+func (s *SecretStore) load(ctx context.Context) (*KeyPair, error) {
+	secret, err := s.Client.CoreV1().Secrets(s.Namespace).Get(ctx, s.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the certificate secret %s/%s: %w", s.Namespace, s.Name, err)
+	}
+
+	return keyPairOf(secret), nil
+}
+
+// needsRenewal reports whether the key pair is missing, invalid or expires within the renewal window. The CA is
+// checked when the Secret holds its key, a CA of a signer is not renewed by the store.
+func (s *SecretStore) needsRenewal(pair *KeyPair) bool {
+	leaf, err := pair.Leaf()
+	if err != nil {
+		log.Printf("Invalid certificate in the secret %s/%s: %v", s.Namespace, s.Name, err)
+		return true
+	}
+
+	deadline := time.Now().Add(s.renewBefore())
+	if deadline.After(leaf.NotAfter) {
+		return true
+	}
+	if len(pair.CAKey) == 0 {
+		return false
+	}
+
+	ca, err := pair.CA()
+	if err != nil {
+		log.Printf("Invalid CA in the secret %s/%s: %v", s.Namespace, s.Name, err)
+		return true
+	}
+
+	return deadline.After(ca.NotAfter)
+}
+
+func (s *SecretStore) renewBefore() time.Duration {
+	if s.RenewBefore == 0 {
+		return DefaultRenewBefore
+	}
+
+	return s.RenewBefore
+}
+
+// Run keeps the key pair files in the directory in sync with the Secret, checking it at the interval until the
+// context is done. A key pair renewed by any replica is written to the files, where the KeyPairReloader and the CA
+// bundle watcher pick it up.
+func (s *SecretStore) Run(ctx context.Context, dir string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var current *KeyPair
+	for {
+		pair, err := s.Ensure(ctx)
+		if err != nil {
+			log.Printf("Failed to sync the certificate secret: %v", err)
+		} else if current == nil || !pair.Equal(current) {
+			if _, err = pair.WriteFiles(dir); err != nil {
+				log.Printf("Failed to write the certificate files: %v", err)
+			} else {
+				current = pair
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Equal reports whether both key pairs hold the same certificates and key
+func (p *KeyPair) Equal(other *KeyPair) bool {
+	return bytes.Equal(p.CACert, other.CACert) && bytes.Equal(p.Cert, other.Cert) && bytes.Equal(p.Key, other.Key)
+}
+
+// keyPairOf returns the key pair stored in the Secret
+func keyPairOf(secret *corev1.Secret) *KeyPair {
+	return &KeyPair{
+		CACert: secret.Data[corev1.ServiceAccountRootCAKey],
+		CAKey:  secret.Data[CAKeySecretKey],
+		Cert:   secret.Data[corev1.TLSCertKey],
+		Key:    secret.Data[corev1.TLSPrivateKeyKey],
+	}
+}
+
+// secretData returns the data of a TLS Secret holding the key pair, and the key of its CA when known
+func secretData(pair *KeyPair) map[string][]byte {
+	data := map[string][]byte{
+		corev1.ServiceAccountRootCAKey: pair.CACert,
+		corev1.TLSCertKey:              pair.Cert,
+		corev1.TLSPrivateKeyKey:        pair.Key,
+	}
+	if len(pair.CAKey) > 0 {
+		data[CAKeySecretKey] = pair.CAKey
+	}
+
+	return data
+}
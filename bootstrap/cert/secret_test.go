@@ -0,0 +1,135 @@
+package cert_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/chungeun-choi/webhook/bootstrap/cert"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newSecretStore(client *fake.Clientset, validity time.Duration) *cert.SecretStore {
+	return &cert.SecretStore{
+		Client:    client,
+		Namespace: "webhook-system",
+		Name:      "webhook-tls",
+		Options: cert.Options{
+			CommonName: "webhook.webhook-system.svc",
+			DNSNames:   []string{"webhook.webhook-system.svc"},
+			KeyType:    cert.KeyTypeECDSA,
+			Validity:   validity,
+		},
+		RenewBefore: time.Hour,
+	}
+}
+
+func TestSecretStoreShared(t *testing.T) {
+	client := fake.NewSimpleClientset()
+
+	first, err := newSecretStore(client, 24*time.Hour).Ensure(context.TODO())
+	assert.NoError(t, err)
+
+	secret, err := client.CoreV1().Secrets("webhook-system").Get(context.TODO(), "webhook-tls", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, corev1.SecretTypeTLS, secret.Type)
+	assert.Equal(t, first.Cert, secret.Data[corev1.TLSCertKey])
+	assert.NotEmpty(t, secret.Data[cert.CAKeySecretKey])
+	assert.Empty(t, first.CAKey, "The key of the CA should stay in the secret")
+
+	// Another replica loads the key pair rather than generating its own
+	second, err := newSecretStore(client, 24*time.Hour).Ensure(context.TODO())
+	assert.NoError(t, err)
+	assert.True(t, first.Equal(second))
+}
+
+func TestSecretStoreCreateRace(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	winner, err := newSecretStore(client, 24*time.Hour).Ensure(context.TODO())
+	assert.NoError(t, err)
+
+	// The replica does not see the Secret yet when it checks, and loses the race to create it
+	notFound := true
+	client.PrependReactor("get", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if notFound {
+			notFound = false
+			return true, nil, apierrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, "webhook-tls")
+		}
+		return false, nil, nil
+	})
+
+	loser, err := newSecretStore(client, 24*time.Hour).Ensure(context.TODO())
+	assert.NoError(t, err)
+	assert.True(t, winner.Equal(loser))
+}
+
+func TestSecretStoreRenew(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	store := newSecretStore(client, 24*time.Hour)
+
+	current, err := store.Ensure(context.TODO())
+	assert.NoError(t, err)
+
+	// The certificate expires within the renewal window, so it is renewed
+	store.RenewBefore = 48 * time.Hour
+	store.Options.Validity = 30 * 24 * time.Hour
+	renewed, err := store.Ensure(context.TODO())
+	assert.NoError(t, err)
+	assert.False(t, current.Equal(renewed))
+
+	leaf, err := renewed.Leaf()
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(30*24*time.Hour), leaf.NotAfter, 2*time.Minute)
+
+	// A replica losing the race to renew loads the renewed key pair
+	client.PrependReactor("update", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewConflict(schema.GroupResource{Resource: "secrets"}, "webhook-tls", nil)
+	})
+	store.RenewBefore = 60 * 24 * time.Hour
+	loaded, err := store.Ensure(context.TODO())
+	assert.NoError(t, err)
+	assert.True(t, renewed.Equal(loaded))
+}
+
+func TestSecretStoreRenewReusesCA(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	store := newSecretStore(client, 30*24*time.Hour)
+	store.RenewBefore = 24 * time.Hour
+
+	// A certificate about to expire, signed by a CA valid for a year
+	ca, err := cert.GenerateKeyPair(caOptions(365 * 24 * time.Hour))
+	assert.NoError(t, err)
+	current, err := cert.SignKeyPair(monitorOptions(time.Hour), ca.CACert, ca.CAKey)
+	assert.NoError(t, err)
+	_, err = client.CoreV1().Secrets("webhook-system").Create(context.TODO(), &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "webhook-tls", Namespace: "webhook-system"},
+		Type:       corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.ServiceAccountRootCAKey: current.CACert,
+			cert.CAKeySecretKey:            current.CAKey,
+			corev1.TLSCertKey:              current.Cert,
+			corev1.TLSPrivateKeyKey:        current.Key,
+		},
+	}, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	// The certificate is renewed with the same CA, so the CA bundle does not change
+	renewed, err := store.Ensure(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, current.CACert, renewed.CACert)
+	assert.NotEqual(t, current.Cert, renewed.Cert)
+
+	// The CA is renewed once it is within the renewal window itself
+	store.RenewBefore = 400 * 24 * time.Hour
+	store.Options.Validity = 800 * 24 * time.Hour
+	rotated, err := store.Ensure(context.TODO())
+	assert.NoError(t, err)
+	assert.NotEqual(t, current.CACert, rotated.CACert)
+}
@@ -0,0 +1,41 @@
+package cert
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"time"
+)
+
+// WatchFile reads the file at the interval until the context is done and calls onChange with its content every
+// time the content differs from the content read before. The file is read once before the first interval to
+// record the initial content, which is not reported.
+func WatchFile(ctx context.Context, path string, interval time.Duration, onChange func(data []byte)) {
+	current, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Failed to read %s: %v", path, err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			data, err := os.ReadFile(path)
+			if err != nil {
+				log.Printf("Failed to read %s: %v", path, err)
+				continue
+			}
+			if bytes.Equal(data, current) {
+				continue
+			}
+
+			current = data
+			onChange(data)
+		}
+	}
+}
@@ -1,26 +1,48 @@
 package kubernetes
 
 import (
+	"errors"
 	"fmt"
+	"log"
+	"os"
+
+	webhookerrors "github.com/chungeun-choi/webhook/errors"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
+// ServiceAccountCAPath is the CA of the API server mounted into every pod
+const ServiceAccountCAPath = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+
 // ClientInterface abstracts the methods of the Kubernetes client interface.
 type ClientInterface interface {
 	kubernetes.Interface // Embeds the core methods of the Kubernetes client interface.
 	// Add additional methods here if you need to mock specific clientset behavior.
 }
 
+// ClientOptions are the sources a Kubernetes client can be created from. They are tried in order: the in-cluster
+// configuration in a pod, then a kubeconfig file, then the explicit URL and token.
+type ClientOptions struct {
+	IsPod          bool   // use the in-cluster configuration of the service account
+	KubeConfigPath string // kubeconfig file, KUBECONFIG or ~/.kube/config when empty
+	Context        string // context of the kubeconfig, its current context when empty
+	URL            string // URL of the API server for the fallback
+	Token          string // bearer token for the fallback
+	TokenFile      string // file of a rotating bearer token for the fallback, takes precedence over Token
+	CAFile         string // CA of the API server for the fallback, the service account CA when empty
+	Insecure       bool   // skip the verification of the API server certificate for the fallback, for development only
+}
+
 var clientCache ClientInterface
 
 // CreateClientSet initializes the ClientCache if it is not already initialized.
-func CreateClientSet(url, token string) (ClientInterface, error) {
+func CreateClientSet(options *ClientOptions) (ClientInterface, error) {
 	if clientCache != nil {
 		return clientCache, nil
 	}
 
-	clientSet, err := initializeClientSet(url, token)
+	clientSet, err := initializeClientSet(options)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Kubernetes clientset: %w", err)
 	}
@@ -30,8 +52,11 @@ func CreateClientSet(url, token string) (ClientInterface, error) {
 }
 
 // initializeClientSet creates a Kubernetes clientset based on the available configuration.
-func initializeClientSet(url, token string) (ClientInterface, error) {
-	kubernetesConfig := createRestConfig(url, token)
+func initializeClientSet(options *ClientOptions) (ClientInterface, error) {
+	kubernetesConfig, err := RestConfig(options)
+	if err != nil {
+		return nil, err
+	}
 
 	// Create the clientset using the configuration.
 	clientSet, err := kubernetes.NewForConfig(kubernetesConfig)
@@ -42,15 +67,95 @@ func initializeClientSet(url, token string) (ClientInterface, error) {
 	return clientSet, nil
 }
 
-// createRestConfig creates a REST configuration using bootstrap package settings.
-func createRestConfig(url, token string) *rest.Config {
-	//TODO: Implement the logic to read the certificate, key, and CA data from the files.
+// RestConfig returns the REST configuration of the first available source of the options
+func RestConfig(options *ClientOptions) (*rest.Config, error) {
+	if options.IsPod {
+		// The in-cluster configuration reads the rotating service account token from its file periodically
+		log.Printf("Using the in-cluster Kubernetes configuration")
+		return rest.InClusterConfig()
+	}
+
+	config, err := kubeConfig(options)
+	if err == nil {
+		return config, nil
+	}
+
+	// Only a missing kubeconfig falls back to the URL. A kubeconfig or context configured explicitly, or a
+	// kubeconfig that exists but cannot be loaded, is an error rather than silently replaced by the URL.
+	if !errors.Is(err, webhookerrors.ErrKubeConfigNotFound) || options.URL == "" {
+		return nil, err
+	}
+
+	return createRestConfig(options)
+}
+
+// kubeConfig loads the REST configuration of the context from the kubeconfig file
+func kubeConfig(options *ClientOptions) (*rest.Config, error) {
+	// The default loading rules read the files listed in KUBECONFIG and then ~/.kube/config
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = options.KubeConfigPath
+
+	// Without any kubeconfig file the default loading rules fall back to the in-cluster configuration silently,
+	// so check that one exists unless the file or the context was configured explicitly
+	if options.KubeConfigPath == "" && options.Context == "" && !anyFileExists(rules.GetLoadingPrecedence()) {
+		return nil, webhookerrors.ErrKubeConfigNotFound
+	}
+
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		rules, &clientcmd.ConfigOverrides{CurrentContext: options.Context},
+	).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the kubeconfig: %w", err)
+	}
+
+	log.Printf("Using the Kubernetes configuration of the kubeconfig %s", rules.GetDefaultFilename())
+	return config, nil
+}
+
+// anyFileExists reports whether one of the files exists
+func anyFileExists(paths []string) bool {
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
 
-	return &rest.Config{
-		Host:        url,
-		BearerToken: token,
-		TLSClientConfig: rest.TLSClientConfig{
-			Insecure: true,
-		},
+	return false
+}
+
+// createRestConfig creates a REST configuration from the explicit URL and token. The certificate of the API
+// server is verified against the configured CA, the service account CA or the system roots.
+func createRestConfig(options *ClientOptions) (*rest.Config, error) {
+	config := &rest.Config{
+		Host:        options.URL,
+		BearerToken: options.Token,
+	}
+
+	if options.TokenFile != "" {
+		tokenFile, err := NewTokenFile(options.TokenFile, DefaultTokenRefreshPeriod)
+		if err != nil {
+			return nil, err
+		}
+		// The transport sets the token of every request, a static bearer token would take precedence over it
+		config.BearerToken = ""
+		config.WrapTransport = tokenFile.WrapTransport
 	}
+
+	switch {
+	case options.Insecure:
+		log.Printf("Warning: the certificate of the Kubernetes API server %s is not verified", options.URL)
+		config.TLSClientConfig.Insecure = true
+	case options.CAFile != "":
+		if _, err := os.Stat(options.CAFile); err != nil {
+			return nil, fmt.Errorf("failed to read the CA of the Kubernetes API server: %w", err)
+		}
+		config.TLSClientConfig.CAFile = options.CAFile
+	default:
+		if _, err := os.Stat(ServiceAccountCAPath); err == nil {
+			config.TLSClientConfig.CAFile = ServiceAccountCAPath
+		}
+	}
+
+	log.Printf("Using the Kubernetes API server %s", options.URL)
+	return config, nil
 }
@@ -0,0 +1,86 @@
+package kubernetes_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chungeun-choi/webhook/bootstrap/kubernetes"
+	"github.com/stretchr/testify/assert"
+)
+
+const testKubeConfig = `apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: dev
+  cluster:
+    server: https://dev.example.com:6443
+- name: prod
+  cluster:
+    server: https://prod.example.com:6443
+contexts:
+- name: dev
+  context:
+    cluster: dev
+    user: admin
+- name: prod
+  context:
+    cluster: prod
+    user: admin
+users:
+- name: admin
+  user:
+    token: secret
+`
+
+func TestRestConfigKubeConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	assert.NoError(t, os.WriteFile(path, []byte(testKubeConfig), 0600))
+
+	config, err := kubernetes.RestConfig(&kubernetes.ClientOptions{KubeConfigPath: path})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://dev.example.com:6443", config.Host)
+
+	config, err = kubernetes.RestConfig(&kubernetes.ClientOptions{KubeConfigPath: path, Context: "prod"})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://prod.example.com:6443", config.Host)
+	assert.Equal(t, "secret", config.BearerToken)
+
+	// A context configured explicitly must exist, even with a URL to fall back to
+	_, err = kubernetes.RestConfig(&kubernetes.ClientOptions{KubeConfigPath: path, Context: "staging", URL: "https://localhost:6443"})
+	assert.Error(t, err)
+}
+
+func TestRestConfigFallback(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	assert.NoError(t, os.WriteFile(caFile, []byte("ca"), 0600))
+
+	// No kubeconfig file exists, so the URL is used
+	t.Setenv("KUBECONFIG", filepath.Join(t.TempDir(), "missing"))
+	options := &kubernetes.ClientOptions{
+		URL:    "https://localhost:6443",
+		Token:  "token",
+		CAFile: caFile,
+	}
+
+	config, err := kubernetes.RestConfig(options)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://localhost:6443", config.Host)
+	assert.Equal(t, caFile, config.TLSClientConfig.CAFile)
+	assert.False(t, config.TLSClientConfig.Insecure)
+
+	options.CAFile = filepath.Join(t.TempDir(), "missing.crt")
+	_, err = kubernetes.RestConfig(options)
+	assert.Error(t, err)
+
+	// A kubeconfig configured explicitly must exist
+	options.CAFile = caFile
+	options.KubeConfigPath = filepath.Join(t.TempDir(), "missing")
+	_, err = kubernetes.RestConfig(options)
+	assert.Error(t, err)
+
+	// Without a kubeconfig or a URL there is no source to create the client from
+	_, err = kubernetes.RestConfig(&kubernetes.ClientOptions{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,132 @@
+package kubernetes
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTokenRefreshPeriod is how long a token read from a file is used before the file is read again
+const DefaultTokenRefreshPeriod = time.Minute
+
+// TokenFile is a bearer token read from a file, such as a projected service account token that is rotated
+// before it expires. The file is read again when it changes, when the token is older than the refresh period and
+// after the API server rejected the token, so a rotated token is picked up without restarting the process.
+type TokenFile struct {
+	path   string
+	period time.Duration
+
+	mu      sync.Mutex
+	token   string
+	modTime time.Time
+	readAt  time.Time
+	stale   bool
+}
+
+// NewTokenFile reads the token from the file. A period of zero uses DefaultTokenRefreshPeriod.
+func NewTokenFile(path string, period time.Duration) (*TokenFile, error) {
+	if period <= 0 {
+		period = DefaultTokenRefreshPeriod
+	}
+
+	t := &TokenFile{path: path, period: period}
+	if err := t.read(); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Token returns the current token, reading the file again if needed. If the file cannot be read the last token is
+// returned, so a rotation in progress does not fail requests.
+func (t *TokenFile) Token() (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.needsRead() {
+		if err := t.read(); err != nil {
+			if t.token == "" {
+				return "", err
+			}
+			log.Printf("Failed to reload the token from %s, using the previous token: %v", t.path, err)
+		}
+	}
+
+	return t.token, nil
+}
+
+// Invalidate forces the next call of Token to read the file again
+func (t *TokenFile) Invalidate() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.stale = true
+}
+
+// needsRead reports whether the token must be read again. The caller must hold the lock.
+func (t *TokenFile) needsRead() bool {
+	if t.stale || time.Now().Sub(t.readAt) >= t.period {
+		return true
+	}
+
+	info, err := os.Stat(t.path)
+	return err == nil && !info.ModTime().Equal(t.modTime)
+}
+
+// read reads the token from the file. The caller must hold the lock, except in NewTokenFile.
+func (t *TokenFile) read() error {
+	info, err := os.Stat(t.path)
+	if err != nil {
+		return fmt.Errorf("failed to read the token file: %w", err)
+	}
+
+	data, err := os.ReadFile(t.path)
+	if err != nil {
+		return fmt.Errorf("failed to read the token file: %w", err)
+	}
+
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return fmt.Errorf("token file %s is empty", t.path)
+	}
+
+	t.token = token
+	t.modTime = info.ModTime()
+	t.readAt = time.Now()
+	t.stale = false
+
+	return nil
+}
+
+// WrapTransport authenticates every request with the current token and invalidates the token when the API server
+// answers 401 Unauthorized, so the next request reads the file again. It is meant for rest.Config.WrapTransport.
+func (t *TokenFile) WrapTransport(rt http.RoundTripper) http.RoundTripper {
+	return &tokenFileRoundTripper{token: t, rt: rt}
+}
+
+type tokenFileRoundTripper struct {
+	token *TokenFile
+	rt    http.RoundTripper
+}
+
+func (r *tokenFileRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := r.token.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	// A round tripper must not modify the request it was given
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := r.rt.RoundTrip(req)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		r.token.Invalidate()
+	}
+
+	return resp, err
+}
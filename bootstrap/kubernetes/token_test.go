@@ -0,0 +1,87 @@
+package kubernetes_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chungeun-choi/webhook/bootstrap/kubernetes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenFileRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(path, []byte("first\n"), 0600))
+
+	var (
+		mu       sync.Mutex
+		accepted = "first"
+		received []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		received = append(received, r.Header.Get("Authorization"))
+		if r.Header.Get("Authorization") != "Bearer "+accepted {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	tokenFile, err := kubernetes.NewTokenFile(path, time.Hour)
+	assert.NoError(t, err)
+	client := &http.Client{Transport: tokenFile.WrapTransport(http.DefaultTransport)}
+
+	get := func() int {
+		resp, err := client.Get(server.URL)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, get())
+
+	// A rotated file is read again as soon as it changes
+	assert.NoError(t, os.WriteFile(path, []byte("second"), 0600))
+	assert.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)))
+	mu.Lock()
+	accepted = "second"
+	mu.Unlock()
+	assert.Equal(t, http.StatusOK, get())
+
+	// A rejected token is read again on the next request even if the file looks unchanged
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path, []byte("third"), 0600))
+	assert.NoError(t, os.Chtimes(path, info.ModTime(), info.ModTime()))
+	mu.Lock()
+	accepted = "third"
+	mu.Unlock()
+	assert.Equal(t, http.StatusUnauthorized, get())
+	assert.Equal(t, http.StatusOK, get())
+
+	assert.Equal(t, []string{"Bearer first", "Bearer second", "Bearer second", "Bearer third"}, received)
+}
+
+func TestTokenFileKeepsTokenWhenFileIsMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(path, []byte("first"), 0600))
+
+	tokenFile, err := kubernetes.NewTokenFile(path, time.Hour)
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.Remove(path))
+	tokenFile.Invalidate()
+
+	token, err := tokenFile.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "first", token)
+
+	_, err = kubernetes.NewTokenFile(path, time.Hour)
+	assert.Error(t, err)
+}
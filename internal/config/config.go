@@ -3,9 +3,13 @@ package config
 import (
 	"fmt"
 	"github.com/chungeun-choi/webhook/bootstrap/cert"
+	"github.com/chungeun-choi/webhook/bootstrap/kubernetes"
+	"github.com/chungeun-choi/webhook/pkg/patch"
 	"gopkg.in/yaml.v3"
 	"log"
+	"net"
 	"os"
+	"time"
 )
 
 // ServerConfig represents the configuration for the server.
@@ -18,13 +22,70 @@ type ServerConfig struct {
 	KeyFile                string   `yaml:"key_file"`                 // path to the x509 private key matching `CertFile`
 	CaFile                 string   `yaml:"ca_file"`                  // path to the x509 certificate authority file
 	ServiceName            string   `yaml:"service_name"`             // webhook pkg name in k8s
+	ServicePort            int32    `yaml:"service_port"`             // port of the service, 443 when empty
+	ClientConfigMode       string   `yaml:"client_config_mode"`       // service or url, service when running in a pod
 	KubeAPIServerURL       string   `yaml:"kube_api_server_url"`      // k8s cluster host
+	KubeAPIServerCAFile    string   `yaml:"kube_api_server_ca_file"`  // CA of the k8s cluster host, the service account CA when empty
+	KubeAPIInsecure        bool     `yaml:"kube_api_insecure"`        // skip the verification of the k8s cluster host, for development only
+	KubeConfig             string   `yaml:"kube_config"`              // kubeconfig used out of a pod, KUBECONFIG or ~/.kube/config when empty
+	KubeContext            string   `yaml:"kube_context"`             // context of the kubeconfig, its current context when empty
 	AdmissionFailurePolicy string   `yaml:"admission_failure_policy"` // admission failure policy
-	TokenPath              string   `yaml:"token_path"`
+	TokenPath              string   `yaml:"token_path"`               // bearer token file, read again when it is rotated
 	Token                  string
 	IsPod                  bool
+	// pod template paths of custom resources which can be patch targets
+	PodTemplatePaths []patch.TemplatePath `yaml:"pod_template_paths"`
+	// self-signed certificate generated when cert_file and key_file are not provided
+	Certificate CertificateConfig `yaml:"certificate"`
+	// storage of the patch sets, so they survive a restart
+	PatchStore PatchStoreConfig `yaml:"patch_store"`
 }
 
+// PatchStoreConfig represents the configuration of the storage of the patch sets.
+type PatchStoreConfig struct {
+	Type         string `yaml:"type"`           // memory, file or configmap, memory when empty
+	Path         string `yaml:"path"`           // file of the file store, data/patches.json when empty
+	Name         string `yaml:"name"`           // prefix of the ConfigMaps in POD_NAMESPACE of the configmap store, <name>-patches when empty
+	MaxShardSize int    `yaml:"max_shard_size"` // bytes of patch sets per ConfigMap of the configmap store, 900KiB when empty
+}
+
+// Types of the patch store
+const (
+	PatchStoreMemory    = "memory"
+	PatchStoreFile      = "file"
+	PatchStoreConfigMap = "configmap"
+)
+
+// DefaultPatchStorePath is the file of the file patch store when no path is configured
+const DefaultPatchStorePath = "data/patches.json"
+
+// CertificateConfig represents the configuration of the generated certificate.
+type CertificateConfig struct {
+	KeyType     string        `yaml:"key_type"`     // rsa or ecdsa, rsa when empty
+	KeySize     int           `yaml:"key_size"`     // RSA bits or ECDSA curve size, 4096 or 256 when empty
+	Validity    time.Duration `yaml:"validity"`     // e.g. 8760h, a year when empty
+	CAValidity  time.Duration `yaml:"ca_validity"`  // validity of the self-signed CA, ten times the validity when empty
+	Dir         string        `yaml:"dir"`          // output directory, cert when empty
+	DNSNames    []string      `yaml:"dns_names"`    // extra DNS names
+	IPAddresses []string      `yaml:"ip_addresses"` // extra IP addresses
+	SecretName  string        `yaml:"secret_name"`  // TLS secret in POD_NAMESPACE shared by the replicas, local files when empty
+	RenewBefore time.Duration `yaml:"renew_before"` // renew the certificate this long before it or its CA expires, 720h when empty
+
+	CheckInterval time.Duration `yaml:"check_interval"` // how often the expiry of the certificate is checked, 1h when empty
+	Generated     bool          `yaml:"-"`              // the files were generated from a self-signed CA at startup
+
+	Issuer       string `yaml:"issuer"`         // self-signed or csr, self-signed when empty
+	SignerName   string `yaml:"signer_name"`    // signer of the certificate signing request
+	SignerCAFile string `yaml:"signer_ca_file"` // CA of the signer used as the CA bundle, the service account CA when empty
+	AutoApprove  bool   `yaml:"auto_approve"`   // approve the certificate signing request, requires the approve permission
+}
+
+// Issuers of the certificate
+const (
+	IssuerSelfSigned = "self-signed"
+	IssuerCSR        = "csr"
+)
+
 // LoadConfig reads a YAML file and unmarshals its content into a ServerConfig struct.
 func LoadConfig(filePath string) (*ServerConfig, error) {
 	// Read the YAML file.
@@ -44,7 +105,7 @@ func LoadConfig(filePath string) (*ServerConfig, error) {
 		return nil, fmt.Errorf("failed to unmarshal YAML data: %w", err)
 	}
 
-	if config.GenerateCert() != nil {
+	if err = config.GenerateCert(); err != nil {
 		return nil, fmt.Errorf("failed to generate cert: %w", err)
 	}
 
@@ -62,9 +123,78 @@ func LoadConfig(filePath string) (*ServerConfig, error) {
 	// Check if running in a test_patch.
 	config.IsPod = checkRunningInPod()
 
+	if err = config.setClientConfigMode(); err != nil {
+		return nil, err
+	}
+
+	if err = config.setPatchStore(); err != nil {
+		return nil, err
+	}
+
 	return &config, nil
 }
 
+// Client config modes of the registered webhooks
+const (
+	// ClientConfigService registers the webhooks with a reference to the service of the server
+	ClientConfigService = "service"
+	// ClientConfigURL registers the webhooks with the URL of the server, for development out of the cluster
+	ClientConfigURL = "url"
+)
+
+// setClientConfigMode defaults the client config mode to a service reference in a pod and to the URL elsewhere
+func (c *ServerConfig) setClientConfigMode() error {
+	switch c.ClientConfigMode {
+	case "":
+		if c.IsPod && c.ServiceName != "" {
+			c.ClientConfigMode = ClientConfigService
+		} else {
+			c.ClientConfigMode = ClientConfigURL
+		}
+	case ClientConfigService:
+		if c.ServiceName == "" {
+			return fmt.Errorf("service_name is required by the client config mode %s", ClientConfigService)
+		}
+	case ClientConfigURL:
+	default:
+		return fmt.Errorf("unsupported client config mode %q", c.ClientConfigMode)
+	}
+
+	if c.ServicePort == 0 {
+		c.ServicePort = 443
+	}
+
+	return nil
+}
+
+// setPatchStore defaults the patch store to memory, the file of the file store and the name of the configmap store
+func (c *ServerConfig) setPatchStore() error {
+	switch c.PatchStore.Type {
+	case "":
+		c.PatchStore.Type = PatchStoreMemory
+	case PatchStoreMemory:
+	case PatchStoreFile:
+		if c.PatchStore.Path == "" {
+			c.PatchStore.Path = DefaultPatchStorePath
+		}
+	case PatchStoreConfigMap:
+		if c.PatchStore.Name == "" {
+			name := c.Name
+			if name == "" {
+				name = "webhook"
+			}
+			c.PatchStore.Name = name + "-patches"
+		}
+		if c.PatchStore.MaxShardSize < 0 || c.PatchStore.MaxShardSize > 1024*1024 {
+			return fmt.Errorf("patch store max_shard_size must be at most 1MiB, not %d", c.PatchStore.MaxShardSize)
+		}
+	default:
+		return fmt.Errorf("unsupported patch store type %q", c.PatchStore.Type)
+	}
+
+	return nil
+}
+
 // LoadToken reads a token.txt file and returns the token.txt.
 func (c *ServerConfig) loadToken() error {
 	// Read the token.txt file.
@@ -90,15 +220,93 @@ func checkRunningInPod() bool {
 // GenerateCert generates a self-signed certificate if the key and cert files are not provided.
 func (c *ServerConfig) GenerateCert() error {
 	if c.KeyFile == "" || c.CertFile == "" {
-		if info, err := cert.GenerateCert([]string{"self-signed-cert"}, []string{"*"}, "localhost"); err != nil {
-			log.Fatalf(" Failed to generate cert: %v", err)
+		switch c.Certificate.Issuer {
+		case "", IssuerSelfSigned, IssuerCSR:
+		default:
+			return fmt.Errorf("unsupported certificate issuer %q", c.Certificate.Issuer)
+		}
+
+		// A certificate that is within the renewal window as soon as it is issued would be renewed at every check
+		validity := c.Certificate.Validity
+		if validity == 0 {
+			validity = cert.DefaultValidity
+		}
+		renewBefore := c.Certificate.RenewBefore
+		if renewBefore == 0 {
+			renewBefore = cert.DefaultRenewWindow
+		}
+		if renewBefore >= validity {
+			return fmt.Errorf("certificate renew window %s must be shorter than its validity %s", renewBefore, validity)
+		}
+
+		// The files are written from the secret or the certificate signing request once the Kubernetes client is
+		// created
+		if c.Certificate.SecretName != "" || c.Certificate.Issuer == IssuerCSR {
+			info := cert.PathInfo(c.Certificate.Dir)
+			c.KeyFile = info.CertKeyPath
+			c.CertFile = info.CertPath
+			c.CaFile = info.CaCertPath
+			return nil
+		}
+
+		opts, err := c.CertificateOptions()
+		if err != nil {
+			return err
+		}
+
+		if info, err := cert.Generate(*opts); err != nil {
+			log.Printf("Failed to generate cert: %v", err)
 			return err
 		} else {
 			c.KeyFile = info.CertKeyPath
 			c.CertFile = info.CertPath
 			c.CaFile = info.CaCertPath
+			c.Certificate.Generated = true
 		}
 	}
 
 	return nil
 }
+
+// CertificateOptions returns the options of the generated certificate. Its names are the DNS names of the
+// service in the namespace of POD_NAMESPACE, the hostname and the extra DNS names and IP addresses.
+func (c *ServerConfig) CertificateOptions() (*cert.Options, error) {
+	opts := &cert.Options{
+		Organizations: []string{"self-signed-cert"},
+		KeyType:       c.Certificate.KeyType,
+		KeySize:       c.Certificate.KeySize,
+		Validity:      c.Certificate.Validity,
+		CAValidity:    c.Certificate.CAValidity,
+		Dir:           c.Certificate.Dir,
+	}
+
+	if namespace := kubernetes.LoadInformation().Namespace; c.ServiceName != "" && namespace != "" {
+		opts.DNSNames = append(opts.DNSNames,
+			fmt.Sprintf("%s.%s.svc", c.ServiceName, namespace),
+			fmt.Sprintf("%s.%s.svc.cluster.local", c.ServiceName, namespace),
+		)
+	}
+
+	if ip := net.ParseIP(c.Hostname); ip != nil {
+		opts.IPAddresses = append(opts.IPAddresses, ip)
+	} else if c.Hostname != "" {
+		opts.DNSNames = append(opts.DNSNames, c.Hostname)
+	}
+
+	opts.DNSNames = append(opts.DNSNames, c.Certificate.DNSNames...)
+	for _, address := range c.Certificate.IPAddresses {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid certificate IP address %q", address)
+		}
+		opts.IPAddresses = append(opts.IPAddresses, ip)
+	}
+
+	if len(opts.DNSNames) > 0 {
+		opts.CommonName = opts.DNSNames[0]
+	} else if len(opts.IPAddresses) > 0 {
+		opts.CommonName = opts.IPAddresses[0].String()
+	}
+
+	return opts, nil
+}
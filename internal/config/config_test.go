@@ -1,9 +1,13 @@
 package config_test
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"github.com/chungeun-choi/webhook/internal/config"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -57,4 +61,74 @@ func TestLoadConfig(t *testing.T) {
 	assert.Equal(t, "/path/to/certfile.crt", cfg.CertFile)
 	assert.Equal(t, "/path/to/keyfile.key", cfg.KeyFile)
 	assert.Equal(t, "my-webhook-pkg", cfg.ServiceName)
+	assert.Equal(t, config.ClientConfigURL, cfg.ClientConfigMode)
+	assert.Equal(t, int32(443), cfg.ServicePort)
+}
+
+// TestLoadConfigGenerateCert tests the names and key of the generated certificate.
+func TestLoadConfigGenerateCert(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.yaml")
+	content := `
+name: my-webhook-server
+hostname: webhook.example.com
+port: 8443
+service_name: my-webhook
+certificate:
+  key_type: ecdsa
+  key_size: 384
+  validity: 2160h
+  dir: ` + filepath.Join(dir, "cert") + `
+  dns_names:
+    - webhook.internal
+  ip_addresses:
+    - 10.0.0.1
+`
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	t.Setenv("POD_NAMESPACE", "webhook-system")
+
+	cfg, err := config.LoadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "cert", "cert.pem"), cfg.CertFile)
+
+	pair, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	assert.NoError(t, err)
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"my-webhook.webhook-system.svc",
+		"my-webhook.webhook-system.svc.cluster.local",
+		"webhook.example.com",
+		"webhook.internal",
+	}, leaf.DNSNames)
+	assert.Equal(t, "10.0.0.1", leaf.IPAddresses[0].String())
+	assert.Equal(t, x509.ECDSA, leaf.PublicKeyAlgorithm)
+	assert.WithinDuration(t, time.Now().Add(2160*time.Hour), leaf.NotAfter, 2*time.Minute)
+
+	// The serving certificate is signed by the generated CA
+	caPEM, err := os.ReadFile(cfg.CaFile)
+	assert.NoError(t, err)
+	roots := x509.NewCertPool()
+	assert.True(t, roots.AppendCertsFromPEM(caPEM))
+	_, err = leaf.Verify(x509.VerifyOptions{DNSName: "my-webhook.webhook-system.svc", Roots: roots})
+	assert.NoError(t, err)
+}
+
+// TestLoadConfigValidityWithinRenewWindow tests that a validity within the default renewal window is rejected.
+func TestLoadConfigValidityWithinRenewWindow(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.yaml")
+	content := `
+name: my-webhook-server
+hostname: webhook.example.com
+port: 8443
+certificate:
+  validity: 720h
+  dir: ` + filepath.Join(dir, "cert") + `
+`
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+	_, err := config.LoadConfig(path)
+	assert.ErrorContains(t, err, "renew window 720h0m0s must be shorter than its validity 720h0m0s")
 }
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"context"
+	"github.com/chungeun-choi/webhook/bootstrap/cert"
+	"github.com/chungeun-choi/webhook/internal/server"
+	"log"
+	"os"
+)
+
+// caBundleSyncer is a manager of webhook configurations whose CA bundle follows the CA file
+type caBundleSyncer interface {
+	SyncCABundle(ctx context.Context, caBundle []byte) ([]string, error)
+}
+
+// WatchCABundle writes the CA file into the CA bundle of every webhook configuration registered by the server,
+// once at startup and then every time the CA file changes
+func WatchCABundle(ctx context.Context, s *server.Server) {
+	if s.Config.CaFile == "" {
+		return
+	}
+
+	kinds := []string{"mutating", "validating"}
+	managers := []caBundleSyncer{mutatingManger, validatingManager}
+
+	syncAll := func(caBundle []byte) {
+		for i, manager := range managers {
+			updated, err := manager.SyncCABundle(ctx, caBundle)
+			if len(updated) > 0 {
+				log.Printf("Updated the CA bundle of the %s webhook configurations %v", kinds[i], updated)
+			}
+			if err != nil {
+				log.Printf("Failed to update the CA bundle of the %s webhook configurations: %v", kinds[i], err)
+			}
+		}
+	}
+
+	go func() {
+		if caBundle, err := os.ReadFile(s.Config.CaFile); err == nil {
+			syncAll(caBundle)
+		}
+
+		cert.WatchFile(ctx, s.Config.CaFile, cert.DefaultReloadInterval, func(caBundle []byte) {
+			log.Printf("CA file %s changed", s.Config.CaFile)
+			syncAll(caBundle)
+		})
+	}()
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"context"
+	"github.com/chungeun-choi/webhook/bootstrap/cert"
+	"github.com/chungeun-choi/webhook/bootstrap/kubernetes"
+	"github.com/chungeun-choi/webhook/internal/config"
+	"github.com/chungeun-choi/webhook/internal/server"
+	"github.com/pkg/errors"
+	"net/http"
+	"os"
+)
+
+var certificateMonitor *cert.ExpiryMonitor
+
+// IssueCertificate writes the certificate files when they come from the cluster rather than from a local
+// self-signed CA. With a secret shared by the replicas, the certificate of the secret is written, issuing it first
+// if no replica did yet, and the files are kept in sync with the secret in the background.
+func IssueCertificate(ctx context.Context, s *server.Server) error {
+	certificate := s.Config.Certificate
+	if certificate.SecretName == "" && certificate.Issuer != config.IssuerCSR {
+		return nil
+	}
+
+	issuer, err := certificateIssuer(s)
+	if err != nil {
+		return err
+	}
+
+	// The files must exist before the server starts and the managers read the CA
+	if certificate.SecretName == "" {
+		pair, err := issuer.Issue(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = pair.WriteFiles(certificate.Dir)
+		return errors.Wrap(err, "failed to write the certificate files")
+	}
+
+	namespace := kubernetes.LoadInformation().Namespace
+	if namespace == "" {
+		return errors.New("POD_NAMESPACE is required by the certificate secret")
+	}
+
+	kubeClient, err := kubernetes.CreateClientSet(clientOptions(s))
+	if err != nil {
+		return err
+	}
+
+	store := &cert.SecretStore{
+		Client:      kubeClient,
+		Namespace:   namespace,
+		Name:        certificate.SecretName,
+		Issuer:      issuer,
+		RenewBefore: certificate.RenewBefore,
+	}
+
+	pair, err := store.Ensure(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err = pair.WriteFiles(certificate.Dir); err != nil {
+		return errors.Wrap(err, "failed to write the certificate files")
+	}
+
+	go store.Run(ctx, certificate.Dir, cert.DefaultSecretSyncInterval)
+
+	return nil
+}
+
+// certificateIssuer returns the issuer of the certificate in the configuration
+func certificateIssuer(s *server.Server) (cert.Issuer, error) {
+	opts, err := s.Config.CertificateOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	certificate := s.Config.Certificate
+	if certificate.Issuer != config.IssuerCSR {
+		return &cert.SelfSignedIssuer{Options: *opts}, nil
+	}
+
+	kubeClient, err := kubernetes.CreateClientSet(clientOptions(s))
+	if err != nil {
+		return nil, err
+	}
+
+	caFile := certificate.SignerCAFile
+	if caFile == "" {
+		caFile = kubernetes.ServiceAccountCAPath
+	}
+	caCert, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the CA of the signer")
+	}
+
+	return &cert.CSRIssuer{
+		Client:      kubeClient,
+		Name:        opts.CommonName,
+		SignerName:  certificate.SignerName,
+		Options:     *opts,
+		CACert:      caCert,
+		AutoApprove: certificate.AutoApprove,
+	}, nil
+}
+
+// RegisterCertificateHandlers starts monitoring the expiry of the served certificate and registers its status
+// endpoint. The certificate is renewed by the monitor when it was issued locally, either self-signed or through a
+// certificate signing request; a certificate of a secret is renewed by the secret store and a certificate provided
+// by the user is only reported.
+func RegisterCertificateHandlers(ctx context.Context, s *server.Server) error {
+	certificate := s.Config.Certificate
+
+	paths := &cert.CertPathInfo{
+		CaCertPath:  s.Config.CaFile,
+		CertPath:    s.Config.CertFile,
+		CertKeyPath: s.Config.KeyFile,
+	}
+	if certificate.Generated {
+		paths.CaKeyPath = cert.PathInfo(certificate.Dir).CaKeyPath
+	}
+
+	certificateMonitor = &cert.ExpiryMonitor{
+		Paths:       paths,
+		RenewWindow: certificate.RenewBefore,
+	}
+	if certificate.SecretName == "" && (certificate.Generated || certificate.Issuer == config.IssuerCSR) {
+		issuer, err := certificateIssuer(s)
+		if err != nil {
+			return err
+		}
+		certificateMonitor.Issuer = issuer
+	}
+
+	interval := certificate.CheckInterval
+	if interval == 0 {
+		interval = cert.DefaultMonitorInterval
+	}
+	go certificateMonitor.Run(ctx, interval)
+
+	s.AddHandler("/cert", map[string]map[string]http.HandlerFunc{
+		"/status": {"GET": getCertificateStatusHandler},
+	})
+
+	return nil
+}
+
+// getCertificateStatusHandler returns the days to expiry of the served certificate and its CA as of the last check
+func getCertificateStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	status := certificateMonitor.Status()
+	if status.Error != "" {
+		server.WriteJson(w, http.StatusInternalServerError, status)
+		return
+	}
+
+	server.WriteJson(w, http.StatusOK, status)
+}
@@ -1,8 +1,13 @@
 package handlers
 
 import (
+	"context"
+	"fmt"
+	"github.com/chungeun-choi/webhook/bootstrap/kubernetes"
+	"github.com/chungeun-choi/webhook/internal/config"
 	"github.com/chungeun-choi/webhook/internal/server"
 	"github.com/pkg/errors"
+	v1 "k8s.io/api/admissionregistration/v1"
 	"net/http"
 )
 
@@ -24,10 +29,63 @@ func getMainHandler(w http.ResponseWriter, r *http.Request) {
 
 func InitHandler(server *server.Server) error {
 	HandlerMain(server)
-	if RegisterMutatingHandler(server) != nil {
-		return errors.New("failed to register mutating handler")
+	if err := IssueCertificate(context.Background(), server); err != nil {
+		return errors.Wrap(err, "failed to issue the certificate")
 	}
-	RegisterPatchHandlers(server)
+	if err := RegisterMutatingHandler(server); err != nil {
+		return errors.Wrap(err, "failed to register mutating handler")
+	}
+	if err := RegisterValidatingHandler(server); err != nil {
+		return errors.Wrap(err, "failed to register validating handler")
+	}
+	if err := RegisterPatchHandlers(server); err != nil {
+		return errors.Wrap(err, "failed to register patch handler")
+	}
+	RegisterResolverHandlers(server)
+	RegisterPolicyHandlers(server)
+	if err := RegisterCertificateHandlers(context.Background(), server); err != nil {
+		return errors.Wrap(err, "failed to register certificate handler")
+	}
+	WatchCABundle(context.Background(), server)
 
 	return nil
 }
+
+// serviceReference returns the service the registered webhooks call in the service client config mode, or nil
+// when they call the URL of the server. The namespace of the service is the namespace of the pod.
+func serviceReference(s *server.Server) (*v1.ServiceReference, error) {
+	if s.Config.ClientConfigMode != config.ClientConfigService {
+		return nil, nil
+	}
+
+	namespace := kubernetes.LoadInformation().Namespace
+	if namespace == "" {
+		return nil, errors.New("POD_NAMESPACE is required by the service client config mode")
+	}
+
+	port := s.Config.ServicePort
+	return &v1.ServiceReference{
+		Namespace: namespace,
+		Name:      s.Config.ServiceName,
+		Port:      &port,
+	}, nil
+}
+
+// serverURL returns the URL of the server called by the registered webhooks in the url client config mode
+func serverURL(s *server.Server) string {
+	return fmt.Sprintf("https://%s:%d", s.Config.Hostname, s.Config.Port)
+}
+
+// clientOptions returns the sources of the Kubernetes client in the configuration
+func clientOptions(s *server.Server) *kubernetes.ClientOptions {
+	return &kubernetes.ClientOptions{
+		IsPod:          s.Config.IsPod,
+		KubeConfigPath: s.Config.KubeConfig,
+		Context:        s.Config.KubeContext,
+		URL:            s.Config.KubeAPIServerURL,
+		Token:          s.Config.Token,
+		TokenFile:      s.Config.TokenPath,
+		CAFile:         s.Config.KubeAPIServerCAFile,
+		Insecure:       s.Config.KubeAPIInsecure,
+	}
+}
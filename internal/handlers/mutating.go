@@ -19,9 +19,14 @@ var (
 )
 
 func RegisterMutatingHandler(s *server.Server) error {
-	kubeClient, err := kubernetes.CreateClientSet(s.Config.KubeAPIServerURL, s.Config.Token)
+	kubeClient, err := kubernetes.CreateClientSet(clientOptions(s))
 	if err != nil {
-		return errors.New("failed to create Kubernetes clientset")
+		return err
+	}
+
+	service, err := serviceReference(s)
+	if err != nil {
+		return err
 	}
 
 	failurePolicy = v1.FailurePolicyType(s.Config.AdmissionFailurePolicy)
@@ -30,9 +35,11 @@ func RegisterMutatingHandler(s *server.Server) error {
 		&mutating.MutatingConfig{
 			Client:           kubeClient,
 			AdmissionVersion: s.Config.AdmissionReviewVersion,
-			URL:              fmt.Sprintf("https://%s:%d", s.Config.Hostname, s.Config.Port),
+			URL:              serverURL(s),
+			Service:          service,
 			FailurePolicy:    failurePolicy,
 			CAPath:           s.Config.CaFile,
+			ManagedBy:        s.Config.Name,
 		},
 	)
 
@@ -105,7 +112,11 @@ func createUpdateMutatingHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Register the mutating webhook configuration
 	if result, err := mutatingManger.Register(*req); err != nil {
-		server.WriteJson(w, http.StatusInternalServerError,
+		code := http.StatusInternalServerError
+		if errors.Is(err, mutating.ErrInvalidRequest) {
+			code = http.StatusBadRequest
+		}
+		server.WriteJson(w, code,
 			&mutating.ResponseBody{
 				Message: fmt.Sprintf("Failed to register mutating webhook: %s", err.Error()),
 			},
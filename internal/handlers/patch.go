@@ -1,23 +1,123 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/chungeun-choi/webhook/bootstrap/kubernetes"
+	"github.com/chungeun-choi/webhook/internal/config"
 	server2 "github.com/chungeun-choi/webhook/internal/server"
+	"github.com/chungeun-choi/webhook/pkg/admission"
 	"github.com/chungeun-choi/webhook/pkg/patch"
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
+	"io"
 	"log"
 	"net/http"
 )
 
-func RegisterPatchHandlers(s *server2.Server) {
+// maxPreviewBodySize limits the size of the sample object of a preview
+const maxPreviewBodySize = 3 * 1024 * 1024
+
+var (
+	patchRegistry *patch.Registry
+)
+
+func RegisterPatchHandlers(s *server2.Server) error {
+	// Register the pod template paths of the custom resources from the configuration, before the persisted patch
+	// sets targeting them are restored
+	for _, entry := range s.Config.PodTemplatePaths {
+		if err := patch.DefaultResolver.Put(entry); err != nil {
+			return errors.Wrapf(err, "invalid pod template path for %s", entry.Kind)
+		}
+	}
+
+	var err error
+	if patchRegistry, err = newPatchRegistry(s); err != nil {
+		return err
+	}
+
 	s.AddHandler("/patch", map[string]map[string]http.HandlerFunc{
 		"":                    {"POST": addPatchHandler, "GET": getPatchHandler},
 		"/{endpoint}":         {"POST": updatePatchHandler, "DELETE": deletePatchHandler},
-		"/{endpoint}/clear":   {"GET": clearPatchHandler},
+		"/{endpoint}/clear":   {"POST": clearPatchHandler},
 		"/{endpoint}/trigger": {"POST": triggerPatchHandler},
+		"/{endpoint}/preview": {"POST": previewPatchHandler},
 	})
+
+	return nil
+}
+
+// newPatchRegistry creates the patch registry backed by the patch store of the configuration
+func newPatchRegistry(s *server2.Server) (*patch.Registry, error) {
+	switch s.Config.PatchStore.Type {
+	case config.PatchStoreFile:
+		store, err := patch.NewFileStore(s.Config.PatchStore.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		// The custom resources registered through the management API are restored before the patch sets
+		// targeting them
+		if err = patch.DefaultResolver.Persist(store); err != nil {
+			return nil, err
+		}
+
+		registry, err := patch.NewPersistentRegistry(store)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Restored %d patch sets from %s", len(registry.List()), s.Config.PatchStore.Path)
+
+		return registry, nil
+	case config.PatchStoreConfigMap:
+		kubeClient, err := kubernetes.CreateClientSet(clientOptions(s))
+		if err != nil {
+			return nil, err
+		}
+
+		namespace := kubernetes.LoadInformation().Namespace
+		if namespace == "" {
+			return nil, errors.New("POD_NAMESPACE is required by the configmap patch store")
+		}
+
+		store := &patch.ConfigMapStore{
+			Client:       kubeClient,
+			Namespace:    namespace,
+			Name:         s.Config.PatchStore.Name,
+			MaxShardSize: s.Config.PatchStore.MaxShardSize,
+		}
+
+		if err = patch.DefaultResolver.Persist(store); err != nil {
+			return nil, err
+		}
+
+		registry, err := patch.NewPersistentRegistry(store)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Restored %d patch sets from the ConfigMaps %s/%s", len(registry.List()), namespace, store.Name)
+
+		// Every replica converges on the pod template paths and the patch sets written by the others, the pod
+		// template paths first so the patch sets targeting them compile
+		go func() {
+			err := store.Watch(context.Background(), func(patchSets []patch.PatchBase) {
+				if entries, err := store.LoadTemplatePaths(); err != nil {
+					log.Printf("Failed to sync the pod template paths: %v", err)
+				} else {
+					patch.DefaultResolver.Sync(entries)
+				}
+				registry.Sync(patchSets)
+			})
+			if err != nil {
+				log.Printf("Failed to watch the patch store: %v", err)
+			}
+		}()
+
+		return registry, nil
+	default:
+		return patch.NewRegistry(), nil
+	}
 }
 
 // GetPatchHandler returns the patch operations for the given endpoint
@@ -33,13 +133,16 @@ func getPatchHandler(w http.ResponseWriter, r *http.Request) {
 	if req = r.URL.Query().Get("endpoint"); req == "" {
 		rsp := new(patch.ResponsePatchList)
 
-		if len(patch.ManagerMap) == 0 {
-			w.WriteHeader(http.StatusNoContent)
+		managers := patchRegistry.List()
+		if len(managers) == 0 {
+			server2.WriteJson(w, http.StatusNoContent, nil)
+			return
 		}
 
-		for k, v := range patch.ManagerMap {
+		for _, v := range managers {
 			rsp.PatchList = append(rsp.PatchList, patch.ResponsePatch{
-				EndpointPath:    k,
+				EndpointPath:    v.Endpoint(),
+				Objects:         v.GetObjects(),
 				PatchOperations: v.GetPatchOperations(),
 			})
 		}
@@ -49,11 +152,12 @@ func getPatchHandler(w http.ResponseWriter, r *http.Request) {
 	} else {
 		rsp := new(patch.ResponsePatch)
 
-		if result, ok := patch.ManagerMap[req]; !ok {
+		if result, ok := patchRegistry.Get(req); !ok {
 			http.Error(w, "Patch manager not found", http.StatusNotFound)
 			return
 		} else {
 			rsp.EndpointPath = req
+			rsp.Objects = result.GetObjects()
 			rsp.PatchOperations = result.GetPatchOperations()
 		}
 
@@ -71,20 +175,24 @@ func addPatchHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var (
-		req *patch.RequestPatch
+		req patch.RequestPatch
 		rsp *patch.ResponseBody
 	)
 
+	// A null body decodes into the zero request, which has no endpoint
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	if req.EndpointPath == "" {
+		http.Error(w, "Missing endpoint", http.StatusBadRequest)
+		return
+	}
 
-	pm := patch.NewPatchManager(req.EndpointPath)
-	err = pm.AddPatchOperations(*req)
+	_, err = patchRegistry.Add(req.EndpointPath, req.Objects)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writePatchError(w, err)
 		return
 	}
 
@@ -107,16 +215,19 @@ func updatePatchHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	pm, ok := patch.ManagerMap[req.EndpointPath]
-	if !ok {
+	if endpoint := mux.Vars(r)["endpoint"]; endpoint != "" {
+		req.EndpointPath = endpoint
+	}
+
+	if _, ok := patchRegistry.Get(req.EndpointPath); !ok {
 		log.Printf("Patch manager not found for endpoint %s", req.EndpointPath)
 		http.Error(w, fmt.Sprintf("Patch manager not found for endpoint %s", req.EndpointPath), http.StatusBadRequest)
 		return
 	}
 
-	err = pm.UpdatePatchOperation(req)
+	_, err = patchRegistry.Put(req.EndpointPath, req.Objects)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writePatchError(w, err)
 		return
 	}
 
@@ -130,19 +241,21 @@ func clearPatchHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	endpointPath := r.URL.Query().Get("endpoint")
+	endpointPath := endpointVar(r)
 	if endpointPath == "" {
 		http.Error(w, "Missing endpoint query parameter", http.StatusBadRequest)
 		return
 	}
 
-	pm, ok := patch.ManagerMap[endpointPath]
-	if !ok {
+	if _, ok := patchRegistry.Get(endpointPath); !ok {
 		http.Error(w, "Patch manager not found", http.StatusNotFound)
 		return
 	}
 
-	pm.ClearPatchOperations()
+	if _, err := patchRegistry.Put(endpointPath, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	server2.WriteJson(w, http.StatusOK, nil)
 }
@@ -153,20 +266,22 @@ func deletePatchHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	endpointPath := r.URL.Query().Get("endpoint")
+	endpointPath := endpointVar(r)
 	if endpointPath == "" {
 		http.Error(w, "Missing endpoint query parameter", http.StatusBadRequest)
 		return
 	}
 
-	_, ok := patch.ManagerMap[endpointPath]
-	if !ok {
+	deleted, err := patchRegistry.Delete(endpointPath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
 		http.Error(w, "Patch manager not found", http.StatusNotFound)
 		return
 	}
 
-	delete(patch.ManagerMap, endpointPath)
-
 	server2.WriteJson(w, http.StatusOK, nil)
 }
 
@@ -186,7 +301,15 @@ func triggerPatchHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response := patch.Patch(req)
+	review, err := admission.DecodeRequest(w, r)
+	if err != nil {
+		log.Printf("Failed to decode admission review for endpoint %s: %v", req, err)
+		code := admission.ErrorStatusCode(err)
+		server2.WriteJson(w, code, admission.ErrorReview(int32(code), err))
+		return
+	}
+
+	response := review.Respond(patchRegistry.Patch(req, review.Request))
 	if rsp, err := json.Marshal(response); err != nil {
 		server2.WriteJson(w, http.StatusInternalServerError, &patch.ResponseBody{
 			Message: errors.Wrap(err, "Failed to encode response").Error(),
@@ -199,3 +322,74 @@ func triggerPatchHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 }
+
+// previewPatchHandler renders the patch set against a sample object given as JSON or YAML and returns the patch,
+// the mutated object and a unified diff without calling the API server
+func previewPatchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	endpointPath := endpointVar(r)
+	pm, ok := patchRegistry.Get(endpointPath)
+	if !ok {
+		http.Error(w, "Patch manager not found", http.StatusNotFound)
+		return
+	}
+
+	// A truncated sample could still parse and preview a partial object, so an oversized one is rejected
+	sample, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPreviewBodySize))
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		http.Error(w, fmt.Sprintf("Request body larger than %d bytes", maxBytesErr.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil || len(sample) == 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	plan := pm.Plan()
+	preview, err := plan.Preview(sample)
+	if err != nil {
+		server2.WriteJson(w, http.StatusBadRequest, &patch.ResponseBody{
+			Message: errors.Wrap(err, "Failed to preview patch").Error(),
+		})
+		return
+	}
+
+	server2.WriteJson(w, http.StatusOK, &patch.ResponsePreview{
+		EndpointPath: endpointPath,
+		Revision:     plan.Revision(),
+		Preview:      *preview,
+	})
+}
+
+// endpointVar returns the endpoint from the route, falling back to the endpoint query parameter
+func endpointVar(r *http.Request) string {
+	if endpoint := mux.Vars(r)["endpoint"]; endpoint != "" {
+		return endpoint
+	}
+
+	return r.URL.Query().Get("endpoint")
+}
+
+// writePatchError writes the error of registering a patch set. Patch sets failing the typed validation are
+// rejected with 422 and the list of field errors.
+func writePatchError(w http.ResponseWriter, err error) {
+	var validationErr *patch.ValidationError
+	if errors.As(err, &validationErr) {
+		server2.WriteJson(w, http.StatusUnprocessableEntity, &patch.ResponseValidationError{
+			Message: "Invalid patch set",
+			Errors:  validationErr.FieldErrors(),
+		})
+		return
+	}
+	if errors.Is(err, patch.ErrEmptyEndpoint) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	server2 "github.com/chungeun-choi/webhook/internal/server"
+	"github.com/chungeun-choi/webhook/pkg/admission"
+	"github.com/chungeun-choi/webhook/pkg/validating"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"log"
+	"net/http"
+)
+
+var (
+	policyRegistry *validating.PolicyRegistry
+)
+
+func RegisterPolicyHandlers(s *server2.Server) {
+	policyRegistry = validating.NewPolicyRegistry()
+
+	s.AddHandler("/policy", map[string]map[string]http.HandlerFunc{
+		"":                    {"POST": addPolicyHandler, "GET": getPolicyHandler},
+		"/{endpoint}":         {"POST": updatePolicyHandler, "DELETE": deletePolicyHandler},
+		"/{endpoint}/trigger": {"POST": triggerPolicyHandler},
+	})
+}
+
+// getPolicyHandler returns the rules of the given endpoint, or of every endpoint without the endpoint query parameter
+func getPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req string
+
+	if req = r.URL.Query().Get("endpoint"); req == "" {
+		rsp := new(validating.ResponsePolicyList)
+
+		endpoints := policyRegistry.List()
+		if len(endpoints) == 0 {
+			server2.WriteJson(w, http.StatusNoContent, nil)
+			return
+		}
+
+		for _, endpoint := range endpoints {
+			if policy, ok := policyRegistry.Get(endpoint); ok {
+				rsp.Policies = append(rsp.Policies, responsePolicy(endpoint, policy))
+			}
+		}
+
+		server2.WriteJson(w, http.StatusOK, rsp)
+	} else {
+		policy, ok := policyRegistry.Get(req)
+		if !ok {
+			http.Error(w, "Policy not found", http.StatusNotFound)
+			return
+		}
+
+		server2.WriteJson(w, http.StatusOK, responsePolicy(req, policy))
+	}
+}
+
+// addPolicyHandler appends rules to the policy of an endpoint
+func addPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req validating.RequestPolicy
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Endpoint == "" {
+		http.Error(w, "Missing endpoint", http.StatusBadRequest)
+		return
+	}
+
+	rs, err := policyRegistry.AddRules(req.Endpoint, req.Rules)
+	if err != nil {
+		server2.WriteJson(w, http.StatusUnprocessableEntity, &validating.ResponseBody{Message: err.Error()})
+		return
+	}
+
+	server2.WriteJson(w, http.StatusOK, responsePolicy(req.Endpoint, rs))
+}
+
+// updatePolicyHandler replaces the rules of an existing endpoint
+func updatePolicyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req validating.RequestPolicy
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Endpoint = endpointVar(r)
+
+	rs, ok, err := policyRegistry.ReplaceRules(req.Endpoint, req.Rules)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Policy not found for endpoint %s", req.Endpoint), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		server2.WriteJson(w, http.StatusUnprocessableEntity, &validating.ResponseBody{Message: err.Error()})
+		return
+	}
+
+	server2.WriteJson(w, http.StatusOK, responsePolicy(req.Endpoint, rs))
+}
+
+func deletePolicyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	endpoint := endpointVar(r)
+	if !policyRegistry.Delete(endpoint) {
+		http.Error(w, "Policy not found", http.StatusNotFound)
+		return
+	}
+
+	server2.WriteJson(w, http.StatusOK, nil)
+}
+
+// triggerPolicyHandler reviews the admitted object with the policy of the endpoint and allows or denies it
+func triggerPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var (
+		req  string
+		vars = mux.Vars(r)
+	)
+
+	if req = vars["endpoint"]; req == "" {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	review, err := admission.DecodeRequest(w, r)
+	if err != nil {
+		log.Printf("Failed to decode admission review for policy %s: %v", req, err)
+		code := admission.ErrorStatusCode(err)
+		server2.WriteJson(w, code, admission.ErrorReview(int32(code), err))
+		return
+	}
+
+	response := review.Respond(policyRegistry.Review(req, review.Request))
+	if rsp, err := json.Marshal(response); err != nil {
+		server2.WriteJson(w, http.StatusInternalServerError, &validating.ResponseBody{
+			Message: errors.Wrap(err, "Failed to encode response").Error(),
+		})
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if _, err = w.Write(rsp); err != nil {
+			log.Printf("Failed to write response: %v", err)
+		}
+	}
+}
+
+// responsePolicy returns the policy in the form returned by the management API. Policies registered in Go
+// rather than as rules are listed without rules.
+func responsePolicy(endpoint string, policy validating.Policy) validating.ResponsePolicy {
+	rsp := validating.ResponsePolicy{Endpoint: endpoint}
+	if rs, ok := policy.(*validating.RuleSet); ok {
+		rsp.Rules = rs.Rules()
+	}
+
+	return rsp
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/chungeun-choi/webhook/internal/server"
+	"github.com/chungeun-choi/webhook/pkg/patch"
+	"net/http"
+)
+
+func RegisterResolverHandlers(s *server.Server) {
+	s.AddHandler("/resolver", map[string]map[string]http.HandlerFunc{
+		"": {"GET": getResolverHandler, "POST": putResolverHandler, "DELETE": deleteResolverHandler},
+	})
+}
+
+// getResolverHandler returns the pod template paths of every patch target kind
+func getResolverHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rsp := new(patch.ResponseTemplatePathList)
+	rsp.TemplatePaths = patch.DefaultResolver.List()
+	server.WriteJson(w, http.StatusOK, rsp)
+}
+
+// putResolverHandler registers or replaces the pod template paths of a custom resource
+func putResolverHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req patch.TemplatePath
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := patch.DefaultResolver.Put(req); err != nil {
+		code := http.StatusBadRequest
+		if errors.Is(err, patch.ErrBuiltInTemplatePath) {
+			code = http.StatusConflict
+		} else if errors.Is(err, patch.ErrTemplatePathStore) {
+			code = http.StatusInternalServerError
+		}
+		server.WriteJson(w, code, &patch.ResponseBody{
+			Message: fmt.Sprintf("Failed to register pod template paths: %s", err.Error()),
+		})
+		return
+	}
+
+	server.WriteJson(w, http.StatusOK, &patch.ResponseBody{
+		Message: fmt.Sprintf("Pod template paths of %s registered successfully", req.Kind),
+	})
+}
+
+// deleteResolverHandler removes the pod template paths of a custom resource
+func deleteResolverHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("kind") == "" {
+		http.Error(w, "Missing kind query parameter", http.StatusBadRequest)
+		return
+	}
+
+	if err := patch.DefaultResolver.Delete(query.Get("group"), query.Get("version"), query.Get("kind")); err != nil {
+		code := http.StatusNotFound
+		if errors.Is(err, patch.ErrBuiltInTemplatePath) {
+			code = http.StatusConflict
+		} else if errors.Is(err, patch.ErrTemplatePathStore) {
+			code = http.StatusInternalServerError
+		}
+		server.WriteJson(w, code, &patch.ResponseBody{
+			Message: fmt.Sprintf("Failed to delete pod template paths: %s", err.Error()),
+		})
+		return
+	}
+
+	server.WriteJson(w, http.StatusOK, &patch.ResponseBody{
+		Message: fmt.Sprintf("Pod template paths of %s deleted successfully", query.Get("kind")),
+	})
+}
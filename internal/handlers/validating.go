@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/chungeun-choi/webhook/bootstrap/kubernetes"
+	"github.com/chungeun-choi/webhook/internal/server"
+	"github.com/chungeun-choi/webhook/pkg/validating"
+	"github.com/gorilla/mux"
+	v1 "k8s.io/api/admissionregistration/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"net/http"
+)
+
+var (
+	validatingManager *validating.ValidatingManager
+)
+
+func RegisterValidatingHandler(s *server.Server) error {
+	kubeClient, err := kubernetes.CreateClientSet(clientOptions(s))
+	if err != nil {
+		return err
+	}
+
+	service, err := serviceReference(s)
+	if err != nil {
+		return err
+	}
+
+	validatingManager = validating.NewValidateManager(
+		&validating.ValidatingConfig{
+			Client:           kubeClient,
+			AdmissionVersion: s.Config.AdmissionReviewVersion,
+			URL:              serverURL(s),
+			Service:          service,
+			FailurePolicy:    v1.FailurePolicyType(s.Config.AdmissionFailurePolicy),
+			CAPath:           s.Config.CaFile,
+			ManagedBy:        s.Config.Name,
+		},
+	)
+
+	s.AddHandler("/validating", map[string]map[string]http.HandlerFunc{
+		"":        {"POST": createUpdateValidatingHandler},
+		"/{name}": {"DELETE": deleteValidatingHandler, "GET": getValidatingHandler},
+	})
+
+	return nil
+}
+
+func getValidatingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var (
+		req string
+		rsp *validating.ResponseGetRulesBody
+	)
+
+	vars := mux.Vars(r)
+	if req = vars["name"]; req == "" {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	} else {
+		// Get the list of validating webhook configurations
+		if result, err := validatingManager.Get(req); err != nil {
+			// If the validating webhook configuration is not found, return 404
+			if apierrors.IsNotFound(err) {
+				server.WriteJson(w, http.StatusNotFound,
+					&validating.ResponseBody{
+						Message: fmt.Sprintf("Validating webhook configuration %s not found", req),
+					},
+				)
+				return
+			}
+			server.WriteJson(w, http.StatusInternalServerError,
+				&validating.ResponseBody{
+					Message: fmt.Sprintf("Failed to list validating webhooks: %s", err.Error()),
+				},
+			)
+			return
+		} else {
+			rsp = new(validating.ResponseGetRulesBody)
+			rsp.Message = "List of validating webhook configurations"
+			rsp.WebhookConfiguration = result.ValidatingWebhookConfiguration
+			server.WriteJson(w, http.StatusOK, rsp)
+		}
+	}
+}
+
+// addValidatingHandler adds a new validating webhook configuration
+func createUpdateValidatingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var (
+		req *validating.RequestAddRulesBody
+		rsp *validating.ResponseAddRulesBody
+	)
+
+	// Decode the request body
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Register the validating webhook configuration
+	if result, err := validatingManager.Register(*req); err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, validating.ErrInvalidRequest) {
+			code = http.StatusBadRequest
+		}
+		server.WriteJson(w, code,
+			&validating.ResponseBody{
+				Message: fmt.Sprintf("Failed to register validating webhook: %s", err.Error()),
+			},
+		)
+		return
+	} else {
+		rsp = new(validating.ResponseAddRulesBody)
+		rsp.Message = "Validating webhook configuration added successfully"
+		rsp.ConfigBuilder = *result
+		server.WriteJson(w, http.StatusOK, rsp)
+	}
+}
+
+// deleteValidatingHandler deletes an existing validating webhook configuration
+func deleteValidatingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var (
+		req string
+		rsp *validating.ResponseBody
+	)
+
+	// Get the name of the validating webhook configuration from the request
+	vars := mux.Vars(r)
+	if req = vars["name"]; req == "" {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	} else {
+		// Delete the validating webhook configuration
+		if err := validatingManager.Delete(req); err != nil {
+			server.WriteJson(w, http.StatusInternalServerError,
+				validating.ResponseBody{Message: fmt.Sprintf("Failed to delete validating webhook: %s", err.Error())},
+			)
+			return
+		}
+
+		rsp = new(validating.ResponseBody)
+		rsp.Message = "Validating webhook configuration deleted successfully"
+		server.WriteJson(w, http.StatusOK, rsp)
+	}
+}
@@ -1,7 +1,10 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"github.com/chungeun-choi/webhook/bootstrap/cert"
 	"github.com/chungeun-choi/webhook/internal/config"
 	"log"
 	"net/http"
@@ -29,8 +32,24 @@ func (s *Server) Run() {
 	address := fmt.Sprintf("%v:%v", s.Config.Hostname, s.Config.Port)
 	log.Printf("Starting server on %s\n", address)
 
+	// Serve the certificate through a reloader, so a rotated certificate is served without a restart
+	reloader, err := cert.NewKeyPairReloader(s.Config.CertFile, s.Config.KeyFile)
+	if err != nil {
+		log.Fatalf("Failed to load the certificate: %v", err)
+	}
+	go reloader.Run(context.Background(), cert.DefaultReloadInterval)
+
+	server := &http.Server{
+		Addr:    address,
+		Handler: s.Router,
+		TLSConfig: &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: reloader.GetCertificate,
+		},
+	}
+
 	// Run the server
-	if err := http.ListenAndServeTLS(address, s.Config.CertFile, s.Config.KeyFile, s.Router); err != nil {
+	if err := server.ListenAndServeTLS("", ""); err != nil {
 		log.Fatalf("Failed to start the server: %v", err)
 	}
 }
@@ -0,0 +1,140 @@
+package admission
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/pkg/errors"
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// maxReviewBodySize limits the size of an AdmissionReview body (the API server caps objects at ~3MiB)
+const maxReviewBodySize = 7 * 1024 * 1024
+
+var (
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+	ErrMalformedReview      = errors.New("malformed admission review")
+	ErrUnsupportedVersion   = errors.New("unsupported admission review version")
+	ErrTooLarge             = errors.New("admission review too large")
+)
+
+// Review is a decoded AdmissionReview. v1beta1 and v1 share the same wire format, so the request is always
+// held as an admission.k8s.io/v1 object and APIVersion remembers what the API server sent.
+type Review struct {
+	APIVersion string
+	Request    *admissionv1.AdmissionRequest
+}
+
+// DecodeRequest reads an AdmissionReview from the http request body. A body above the size limit is rejected
+// rather than truncated.
+func DecodeRequest(w http.ResponseWriter, r *http.Request) (*Review, error) {
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || mediaType != "application/json" {
+			return nil, errors.Wrapf(ErrUnsupportedMediaType, "content type %q, expected application/json", contentType)
+		}
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxReviewBodySize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, errors.Wrapf(ErrTooLarge, "body larger than %d bytes", maxBytesErr.Limit)
+		}
+		return nil, errors.Wrap(err, "failed to read request body")
+	}
+
+	return Decode(body)
+}
+
+// Decode parses an admission.k8s.io/v1 or v1beta1 AdmissionReview
+func Decode(data []byte) (*Review, error) {
+	if len(data) == 0 {
+		return nil, errors.Wrap(ErrMalformedReview, "empty body")
+	}
+
+	var typeMeta metav1.TypeMeta
+	if err := json.Unmarshal(data, &typeMeta); err != nil {
+		return nil, errors.Wrapf(ErrMalformedReview, "%v", err)
+	}
+
+	switch typeMeta.APIVersion {
+	case admissionv1.SchemeGroupVersion.String(), admissionv1beta1.SchemeGroupVersion.String():
+	default:
+		return nil, errors.Wrapf(ErrUnsupportedVersion, "%q", typeMeta.APIVersion)
+	}
+
+	if typeMeta.Kind != "AdmissionReview" {
+		return nil, errors.Wrapf(ErrMalformedReview, "unexpected kind %q", typeMeta.Kind)
+	}
+
+	var review admissionv1.AdmissionReview
+	if err := json.Unmarshal(data, &review); err != nil {
+		return nil, errors.Wrapf(ErrMalformedReview, "%v", err)
+	}
+
+	if review.Request == nil {
+		return nil, errors.Wrap(ErrMalformedReview, "missing request")
+	}
+
+	if review.Request.UID == "" {
+		return nil, errors.Wrap(ErrMalformedReview, "missing request uid")
+	}
+
+	return &Review{
+		APIVersion: typeMeta.APIVersion,
+		Request:    review.Request,
+	}, nil
+}
+
+// Respond builds the AdmissionReview answer in the same apiVersion as the request and echoes the request uid
+func (r *Review) Respond(response *admissionv1.AdmissionResponse) *admissionv1.AdmissionReview {
+	if response == nil {
+		response = new(admissionv1.AdmissionResponse)
+	}
+	response.UID = r.Request.UID
+
+	return &admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: r.APIVersion,
+			Kind:       "AdmissionReview",
+		},
+		Response: response,
+	}
+}
+
+// ErrorReview builds an AdmissionReview that rejects a request which could not be decoded
+func ErrorReview(code int32, err error) *admissionv1.AdmissionReview {
+	return &admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: admissionv1.SchemeGroupVersion.String(),
+			Kind:       "AdmissionReview",
+		},
+		Response: &admissionv1.AdmissionResponse{
+			Allowed: false,
+			Result: &metav1.Status{
+				Status:  metav1.StatusFailure,
+				Code:    code,
+				Reason:  metav1.StatusReasonBadRequest,
+				Message: fmt.Sprintf("invalid admission review: %v", err),
+			},
+		},
+	}
+}
+
+// ErrorStatusCode maps a decode error to the http status code returned to the caller
+func ErrorStatusCode(err error) int {
+	if errors.Is(err, ErrUnsupportedMediaType) {
+		return http.StatusUnsupportedMediaType
+	}
+	if errors.Is(err, ErrTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+
+	return http.StatusBadRequest
+}
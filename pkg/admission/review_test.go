@@ -0,0 +1,68 @@
+package admission_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chungeun-choi/webhook/pkg/admission"
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+const testReviewTemplate = `{
+  "apiVersion": "%s",
+  "kind": "AdmissionReview",
+  "request": {
+    "uid": "705ab4f5-6393-11e8-b7cc-42010a800002",
+    "kind": {"group": "apps", "version": "v1", "kind": "Deployment"},
+    "resource": {"group": "apps", "version": "v1", "resource": "deployments"},
+    "operation": "CREATE",
+    "object": {"apiVersion": "apps/v1", "kind": "Deployment"}
+  }
+}`
+
+// TestDecode tests that both v1 and v1beta1 reviews are decoded and answered in the same version.
+func TestDecode(t *testing.T) {
+	for _, version := range []string{"admission.k8s.io/v1", "admission.k8s.io/v1beta1"} {
+		review, err := admission.Decode([]byte(fmt.Sprintf(testReviewTemplate, version)))
+		assert.NoError(t, err, "Decoding %s review should not produce an error", version)
+		assert.Equal(t, version, review.APIVersion)
+		assert.Equal(t, "Deployment", review.Request.Kind.Kind)
+
+		rsp := review.Respond(&admissionv1.AdmissionResponse{Allowed: true})
+		assert.Equal(t, version, rsp.APIVersion)
+		assert.Equal(t, "AdmissionReview", rsp.Kind)
+		assert.Equal(t, review.Request.UID, rsp.Response.UID)
+	}
+}
+
+// TestDecodeMalformed tests that malformed reviews are rejected.
+func TestDecodeMalformed(t *testing.T) {
+	cases := map[string]string{
+		"empty":       ``,
+		"not json":    `not json`,
+		"bad version": fmt.Sprintf(testReviewTemplate, "admission.k8s.io/v2"),
+		"no request":  `{"apiVersion": "admission.k8s.io/v1", "kind": "AdmissionReview"}`,
+		"no uid":      `{"apiVersion": "admission.k8s.io/v1", "kind": "AdmissionReview", "request": {}}`,
+	}
+
+	for name, body := range cases {
+		_, err := admission.Decode([]byte(body))
+		assert.Error(t, err, "Decoding %s review should produce an error", name)
+	}
+}
+
+// TestDecodeRequestTooLarge tests that an oversized body is rejected rather than truncated.
+func TestDecodeRequestTooLarge(t *testing.T) {
+	review := fmt.Sprintf(testReviewTemplate, "admission.k8s.io/v1")
+	body := review + strings.Repeat(" ", 8*1024*1024)
+
+	r := httptest.NewRequest(http.MethodPost, "/patch/sidecar/trigger", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	_, err := admission.DecodeRequest(httptest.NewRecorder(), r)
+	assert.ErrorIs(t, err, admission.ErrTooLarge)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, admission.ErrorStatusCode(err))
+}
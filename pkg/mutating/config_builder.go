@@ -1,9 +1,8 @@
 package mutating
 
 import (
-	"fmt"
+	"github.com/chungeun-choi/webhook/pkg/webhookconfig"
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 type ConfigBuilder struct {
@@ -19,93 +18,68 @@ func (b *ConfigBuilder) WithMetaInfo(name string) *ConfigBuilder {
 	return b
 }
 
-func (b *ConfigBuilder) WithWebhook(builder *WebhookConfigBuilder) *ConfigBuilder {
-	b.Webhooks = append(b.Webhooks, builder.MutatingWebhook)
+// WithManagedBy labels the configuration as managed by the server, so it can be found again to update its CA bundle
+func (b *ConfigBuilder) WithManagedBy(managedBy string) *ConfigBuilder {
+	webhookconfig.WithManagedBy(&b.ObjectMeta, managedBy)
 	return b
 }
 
-type WebhookConfigBuilder struct {
-	admissionregistrationv1.MutatingWebhook
-}
-
-func NewWebhookConfigBuilder() *WebhookConfigBuilder {
-	return &WebhookConfigBuilder{}
-}
-
-// WithName sets the name of the webhook
-func (b *WebhookConfigBuilder) WithName(name string) *WebhookConfigBuilder {
-	b.Name = name
-	return b
-}
-
-// WithAdmissionReviewVersions sets the admission review versions for the webhook - required
-func (b *WebhookConfigBuilder) WithAdmissionReviewVersions(versions ...string) *WebhookConfigBuilder {
-	b.AdmissionReviewVersions = versions
-	return b
-}
-
-// WithSideEffect sets the side effect for the webhook - required
-func (b *WebhookConfigBuilder) WithSideEffect(sideEffect admissionregistrationv1.SideEffectClass) *WebhookConfigBuilder {
-	b.SideEffects = &sideEffect
+func (b *ConfigBuilder) WithWebhook(builder *WebhookConfigBuilder) *ConfigBuilder {
+	b.Webhooks = append(b.Webhooks, builder.MutatingWebhook())
 	return b
 }
 
-func (b *WebhookConfigBuilder) WithFailurePolicy(policy admissionregistrationv1.FailurePolicyType) *WebhookConfigBuilder {
-	b.FailurePolicy = &policy
-	return b
+// WebhookConfigBuilder builds a mutating webhook from the fields it shares with validating webhooks and its
+// reinvocation policy
+type WebhookConfigBuilder struct {
+	*webhookconfig.WebhookBuilder
+	ReinvocationPolicy *admissionregistrationv1.ReinvocationPolicyType
 }
 
-// WithClientConfig sets the client configuration for the webhook - required
-func (b *WebhookConfigBuilder) WithClientConfig(url, endpoint string, caByte []byte) *WebhookConfigBuilder {
-	//b.ClientConfig.CABundle = caPem
-
-	//Use the direct URL
-	url = fmt.Sprintf("%v/%s/%s/%s", url, "patch", endpoint, "trigger")
-	b.ClientConfig.URL = &url
-	b.ClientConfig.CABundle = caByte
-
-	return b
+func NewWebhookConfigBuilder(webhook *webhookconfig.WebhookBuilder) *WebhookConfigBuilder {
+	return &WebhookConfigBuilder{WebhookBuilder: webhook}
 }
 
-// WithRoles sets the rules for the webhook
-func (b *WebhookConfigBuilder) WithRoles(rules ...Rule) *WebhookConfigBuilder {
-	for _, rule := range rules {
-		var (
-			operations []admissionregistrationv1.OperationType
-			ruleObj    admissionregistrationv1.Rule
-		)
-
-		// Set the rule object
-		ruleObj.APIGroups = rule.APIGroups
-		ruleObj.APIVersions = rule.APIVersions
-		ruleObj.Resources = rule.Resources
-
-		// Convert the string operations to the OperationType
-		for _, op := range rule.Operations {
-			operations = append(operations, admissionregistrationv1.OperationType(op))
-		}
-
-		// Append the rule with operations
-		b.Rules = append(b.Rules, admissionregistrationv1.RuleWithOperations{
-			Operations: operations,
-			Rule:       ruleObj,
-		})
+// WithReinvocationPolicy sets whether the webhook is called again when a later webhook modifies the object
+func (b *WebhookConfigBuilder) WithReinvocationPolicy(policy admissionregistrationv1.ReinvocationPolicyType) *WebhookConfigBuilder {
+	if policy != "" {
+		b.ReinvocationPolicy = &policy
 	}
-
 	return b
 }
 
-func (b *WebhookConfigBuilder) WitNameSpaceSelector(key, value string) *WebhookConfigBuilder {
-	// TODO: Implement MatchExpressions
-	b.NamespaceSelector = &metav1.LabelSelector{
-		MatchLabels: map[string]string{
-			key: value,
-		},
+// MutatingWebhook returns the webhook built
+func (b *WebhookConfigBuilder) MutatingWebhook() admissionregistrationv1.MutatingWebhook {
+	webhook := b.ValidatingWebhook
+	return admissionregistrationv1.MutatingWebhook{
+		Name:                    webhook.Name,
+		ClientConfig:            webhook.ClientConfig,
+		Rules:                   webhook.Rules,
+		FailurePolicy:           webhook.FailurePolicy,
+		MatchPolicy:             webhook.MatchPolicy,
+		NamespaceSelector:       webhook.NamespaceSelector,
+		ObjectSelector:          webhook.ObjectSelector,
+		SideEffects:             webhook.SideEffects,
+		TimeoutSeconds:          webhook.TimeoutSeconds,
+		AdmissionReviewVersions: webhook.AdmissionReviewVersions,
+		ReinvocationPolicy:      b.ReinvocationPolicy,
+		MatchConditions:         webhook.MatchConditions,
 	}
-	return b
 }
 
-func (b *WebhookConfigBuilder) WithObjectSelector() *WebhookConfigBuilder {
-	//TODO: Implement the object selector
-	return b
+// commonWebhook returns the fields the mutating webhook shares with validating webhooks
+func commonWebhook(webhook admissionregistrationv1.MutatingWebhook) admissionregistrationv1.ValidatingWebhook {
+	return admissionregistrationv1.ValidatingWebhook{
+		Name:                    webhook.Name,
+		ClientConfig:            webhook.ClientConfig,
+		Rules:                   webhook.Rules,
+		FailurePolicy:           webhook.FailurePolicy,
+		MatchPolicy:             webhook.MatchPolicy,
+		NamespaceSelector:       webhook.NamespaceSelector,
+		ObjectSelector:          webhook.ObjectSelector,
+		SideEffects:             webhook.SideEffects,
+		TimeoutSeconds:          webhook.TimeoutSeconds,
+		AdmissionReviewVersions: webhook.AdmissionReviewVersions,
+		MatchConditions:         webhook.MatchConditions,
+	}
 }
@@ -1,177 +1,104 @@
 package mutating
 
 import (
-	"context"
-	"fmt"
-	"github.com/chungeun-choi/webhook/bootstrap/kubernetes"
-	"github.com/pkg/errors"
-	"golang.org/x/sync/singleflight"
+	"strings"
+
+	"github.com/chungeun-choi/webhook/pkg/webhookconfig"
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
-	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	admissionregistration "k8s.io/client-go/kubernetes/typed/admissionregistration/v1"
-	"log"
-	"os"
-	"reflect"
-	"strings"
-	"sync"
 )
 
-type MutatingConfig struct {
-	URL              string
-	Client           kubernetes.ClientInterface
-	AdmissionVersion []string
-	FailurePolicy    admissionregistrationv1.FailurePolicyType
-	CAPath           string
-}
+// MutatingConfig is a struct that contains the URL, client, admission version, and failure policy
+type MutatingConfig = webhookconfig.Config
 
-// MutatingManager is a struct that contains the client and the single flight.Group
+// MutatingManager registers the mutating webhook configurations
 type MutatingManager struct {
-	Config             *MutatingConfig                                        // MutatingConfig is a struct that contains the URL, client, admission version, and failure policy
-	admissionInitGroup singleflight.Group                                     // single flight.Group is a struct that provides a duplicate function call suppression
-	admissionV1Client  admissionregistration.AdmissionregistrationV1Interface // Admission registrationV1Interface is an interface that contains the MutatingWebhookConfigurations method
-	once               sync.Once                                              // once is a struct that provides a mechanism for performing exactly one action
-	CAByte             []byte
+	*webhookconfig.Manager[admissionregistrationv1.MutatingWebhookConfiguration, admissionregistrationv1.MutatingWebhookConfigurationList]
 }
 
-// NewMutateManager is a function that creates a new instance of MutatingManager
-func NewMutateManager(config *MutatingConfig) *MutatingManager {
-	// If CAPath is empty, use the default CA
-	if config.CAPath == "" {
-		log.Printf("CAPath is empty, using the default CA")
-		return &MutatingManager{
-			Config: config,
+// kind gives the shared manager access to the mutating webhook configurations
+var kind = webhookconfig.Kind[admissionregistrationv1.MutatingWebhookConfiguration, admissionregistrationv1.MutatingWebhookConfigurationList]{
+	Name:   "mutating",
+	Prefix: "patch",
+	Client: func(v1 admissionregistration.AdmissionregistrationV1Interface) webhookconfig.Client[admissionregistrationv1.MutatingWebhookConfiguration, admissionregistrationv1.MutatingWebhookConfigurationList] {
+		return v1.MutatingWebhookConfigurations()
+	},
+	Equal: equalConfig,
+	Items: func(list *admissionregistrationv1.MutatingWebhookConfigurationList) []admissionregistrationv1.MutatingWebhookConfiguration {
+		return list.Items
+	},
+	ObjectMeta: func(config *admissionregistrationv1.MutatingWebhookConfiguration) *metav1.ObjectMeta {
+		return &config.ObjectMeta
+	},
+	ClientConfigs: func(config *admissionregistrationv1.MutatingWebhookConfiguration) []*admissionregistrationv1.WebhookClientConfig {
+		clientConfigs := make([]*admissionregistrationv1.WebhookClientConfig, 0, len(config.Webhooks))
+		for i := range config.Webhooks {
+			clientConfigs = append(clientConfigs, &config.Webhooks[i].ClientConfig)
 		}
-	}
-
-	// Try to read the CA file from the specified path
-	caBytes, err := os.ReadFile(config.CAPath)
-	if err != nil {
-		log.Printf("Failed to read CA file from %s: %v", config.CAPath, err)
-		return &MutatingManager{
-			Config: config,
-		}
-	}
+		return clientConfigs
+	},
+}
 
-	return &MutatingManager{
-		Config: config,
-		CAByte: caBytes,
-	}
+// NewMutateManager is a function that creates a new instance of MutatingManager
+func NewMutateManager(config *MutatingConfig) *MutatingManager {
+	return &MutatingManager{webhookconfig.NewManager(config, kind)}
 }
 
 // Register is a method that registers the mutating webhook
 func (m *MutatingManager) Register(req RequestAddRulesBody) (*ConfigBuilder, error) {
 	req.Name = strings.ToLower(req.Name)
-
-	// NewMutatingConfigBuilder is a function that creates a new instance of ConfigBuilder
-	mutatingConfig := NewMutatingConfigBuilder().WithMetaInfo(req.Name)
-	mutatingConfig.WithWebhook(NewWebhookConfigBuilder().
-		WithName(req.Name+".admission"+".webhook").                  // required
-		WithSideEffect(admissionregistrationv1.SideEffectClassNone). // required
-		WithAdmissionReviewVersions(m.Config.AdmissionVersion...).   // required
-		WithClientConfig(m.Config.URL, req.Name, m.CAByte).          // required
-		WithRoles(req.Rules...).WithFailurePolicy(m.Config.FailurePolicy),
-	)
-
-	// getOldConfig is a method that retrieves the old configuration for the mutating webhook
-	if old, err := m.Get(mutatingConfig.Name); err != nil {
-		if apierrors.IsNotFound(err) {
-			return m.create(*mutatingConfig)
-		} else {
-			return nil, errors.Wrap(err, "failed to get old config")
-		}
-	} else {
-		return m.update(mutatingConfig, old)
-	}
-}
-
-// Create is a method that creates a new configuration for the mutating webhook
-func (m *MutatingManager) create(new ConfigBuilder) (*ConfigBuilder, error) {
-	v1, err := m.GetAdmissionV1()
-	if err != nil {
+	if err := webhookconfig.ValidateRequest(req, validateOptions); err != nil {
 		return nil, err
 	}
 
-	newConfig, err := v1.MutatingWebhookConfigurations().Create(context.TODO(), &new.MutatingWebhookConfiguration, meta.CreateOptions{})
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to create new config.")
-	}
-
-	return &ConfigBuilder{
-		*newConfig,
-	}, nil
-}
-
-// Update is a method that updates the configuration for the mutating webhook
-func (m *MutatingManager) update(new, old *ConfigBuilder) (*ConfigBuilder, error) {
-	if equalConfig(new, old) {
-		log.Printf(" no need to update the configuration for the mutating webhook %s", old.Name)
-		return old, nil
-	} else {
-		v1, err := m.GetAdmissionV1()
-		if err != nil {
-			return nil, err
-		}
-
-		new.MutatingWebhookConfiguration.ResourceVersion = old.ResourceVersion
-
-		result, err := v1.MutatingWebhookConfigurations().Update(context.TODO(), &new.MutatingWebhookConfiguration, meta.UpdateOptions{})
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to update the configuration for the mutating webhook")
-		} else {
-			return &ConfigBuilder{
-				*result,
-			}, nil
-		}
-
+	// NewMutatingConfigBuilder is a function that creates a new instance of ConfigBuilder
+	mutatingConfig := NewMutatingConfigBuilder().WithMetaInfo(req.Name).WithManagedBy(m.ManagedBy())
+	for _, webhook := range webhookconfig.WebhooksOf(req) {
+		mutatingConfig.WithWebhook(NewWebhookConfigBuilder(m.NewWebhook(webhook.Name, webhook.Endpoint, webhook.Options.options())).
+			WithReinvocationPolicy(webhook.Options.ReinvocationPolicy))
 	}
-}
 
-// Delete is a method that deletes the configuration for the mutating webhook
-func (m *MutatingManager) Delete(name string) error {
-	v1, err := m.GetAdmissionV1()
+	result, err := m.Apply(&mutatingConfig.MutatingWebhookConfiguration)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return v1.MutatingWebhookConfigurations().Delete(context.TODO(), name, meta.DeleteOptions{})
+	return &ConfigBuilder{*result}, nil
 }
 
 // Get is a method that retrieves the old configuration for the mutating webhook
 func (m *MutatingManager) Get(name string) (*ConfigBuilder, error) {
-	v1, err := m.GetAdmissionV1()
+	config, err := m.Fetch(name)
 	if err != nil {
 		return nil, err
 	}
 
-	oldConfig, err := v1.MutatingWebhookConfigurations().Get(context.TODO(), name, meta.GetOptions{})
-	if err != nil {
-		return nil, err
+	return &ConfigBuilder{*config}, nil
+}
+
+// equalConfig reports whether the configuration on the server is the desired one, ignoring the metadata and the
+// defaults the server adds
+func equalConfig(desired, current *admissionregistrationv1.MutatingWebhookConfiguration) bool {
+	if !webhookconfig.EqualMeta(&desired.ObjectMeta, &current.ObjectMeta) || len(desired.Webhooks) != len(current.Webhooks) {
+		return false
 	}
 
-	return &ConfigBuilder{
-		*oldConfig,
-	}, nil
-}
+	for i := range desired.Webhooks {
+		if !webhookconfig.EqualWebhook(commonWebhook(desired.Webhooks[i]), commonWebhook(current.Webhooks[i])) ||
+			reinvocationPolicy(desired.Webhooks[i]) != reinvocationPolicy(current.Webhooks[i]) {
+			return false
+		}
+	}
 
-func equalConfig(cur, old *ConfigBuilder) bool {
-	// Use reflect.DeepEqual for deep comparison
-	return reflect.DeepEqual(cur, old)
+	return true
 }
 
-// GetAdmissionV1 is a method that returns the AdmissionregistrationV1Interface
-func (m *MutatingManager) GetAdmissionV1() (admissionregistration.AdmissionregistrationV1Interface, error) {
-	m.once.Do(func() {
-		// Do is a method that executes and returns the result of the function f.
-		v, err, _ := m.admissionInitGroup.Do("admissionV1", func() (interface{}, error) {
-			return m.Config.Client.AdmissionregistrationV1(), nil
-		})
-		if err == nil {
-			m.admissionV1Client = v.(admissionregistration.AdmissionregistrationV1Interface)
-		}
-	})
-	if m.admissionV1Client == nil {
-		return nil, fmt.Errorf("failed to initialize AdmissionregistrationV1 client")
+// reinvocationPolicy returns the reinvocation policy of the webhook, Never being the default of the server
+func reinvocationPolicy(webhook admissionregistrationv1.MutatingWebhook) admissionregistrationv1.ReinvocationPolicyType {
+	if webhook.ReinvocationPolicy == nil {
+		return admissionregistrationv1.NeverReinvocationPolicy
 	}
-	return m.admissionV1Client, nil
+
+	return *webhook.ReinvocationPolicy
 }
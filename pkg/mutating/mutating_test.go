@@ -0,0 +1,329 @@
+package mutating_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/chungeun-choi/webhook/pkg/mutating"
+	"github.com/stretchr/testify/assert"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newTestManager() *mutating.MutatingManager {
+	return mutating.NewMutateManager(&mutating.MutatingConfig{
+		Client:           fake.NewSimpleClientset(),
+		AdmissionVersion: []string{"v1"},
+		URL:              "https://webhook.example.com:8443",
+		FailurePolicy:    admissionregistrationv1.Ignore,
+	})
+}
+
+func TestRegisterSelectors(t *testing.T) {
+	manager := newTestManager()
+
+	result, err := manager.Register(mutating.RequestAddRulesBody{
+		Name: "sidecar",
+		Options: mutating.WebhookOptions{
+			Rules: []mutating.Rule{{
+				APIGroups: []string{"apps"}, APIVersions: []string{"v1"}, Resources: []string{"deployments"}, Operations: []string{"CREATE"},
+			}},
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"sidecar-injection": "enabled"},
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "kubernetes.io/metadata.name", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"kube-system"}},
+				},
+			},
+			ObjectSelector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "sidecar.example.com/skip", Operator: metav1.LabelSelectorOpDoesNotExist},
+				},
+			},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, result.Webhooks, 1)
+
+	webhook := result.Webhooks[0]
+	assert.Equal(t, map[string]string{"sidecar-injection": "enabled"}, webhook.NamespaceSelector.MatchLabels)
+	assert.Equal(t, metav1.LabelSelectorOpNotIn, webhook.NamespaceSelector.MatchExpressions[0].Operator)
+	assert.Equal(t, metav1.LabelSelectorOpDoesNotExist, webhook.ObjectSelector.MatchExpressions[0].Operator)
+
+	stored, err := manager.Get("sidecar")
+	assert.NoError(t, err)
+	assert.Equal(t, webhook.ObjectSelector, stored.Webhooks[0].ObjectSelector)
+}
+
+func TestRegisterInvalidSelector(t *testing.T) {
+	manager := newTestManager()
+
+	for _, selector := range []metav1.LabelSelectorRequirement{
+		{Key: "team", Operator: metav1.LabelSelectorOpIn},
+		{Key: "team", Operator: metav1.LabelSelectorOpExists, Values: []string{"a"}},
+		{Key: "team", Operator: "Matches", Values: []string{"a"}},
+		{Key: "bad key!", Operator: metav1.LabelSelectorOpExists},
+	} {
+		_, err := manager.Register(mutating.RequestAddRulesBody{
+			Name: "sidecar",
+			Options: mutating.WebhookOptions{
+				ObjectSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{selector}},
+			},
+		})
+		assert.True(t, errors.Is(err, mutating.ErrInvalidRequest), "%v", selector)
+	}
+}
+
+func TestRegisterWebhookFields(t *testing.T) {
+	manager := newTestManager()
+	timeout := int32(5)
+
+	result, err := manager.Register(mutating.RequestAddRulesBody{
+		Name: "security",
+		Options: mutating.WebhookOptions{
+			SideEffects:        admissionregistrationv1.SideEffectClassNoneOnDryRun,
+			FailurePolicy:      admissionregistrationv1.Fail,
+			TimeoutSeconds:     &timeout,
+			MatchPolicy:        admissionregistrationv1.Equivalent,
+			ReinvocationPolicy: admissionregistrationv1.IfNeededReinvocationPolicy,
+			MatchConditions: []admissionregistrationv1.MatchCondition{
+				{Name: "exclude-leases", Expression: `request.resource.resource != "leases"`},
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	webhook := result.Webhooks[0]
+	assert.Equal(t, admissionregistrationv1.SideEffectClassNoneOnDryRun, *webhook.SideEffects)
+	assert.Equal(t, admissionregistrationv1.Fail, *webhook.FailurePolicy)
+	assert.Equal(t, int32(5), *webhook.TimeoutSeconds)
+	assert.Equal(t, admissionregistrationv1.Equivalent, *webhook.MatchPolicy)
+	assert.Equal(t, admissionregistrationv1.IfNeededReinvocationPolicy, *webhook.ReinvocationPolicy)
+	assert.Len(t, webhook.MatchConditions, 1)
+
+	// Unset fields fall back to the defaults of the server
+	result, err = manager.Register(mutating.RequestAddRulesBody{Name: "telemetry"})
+	assert.NoError(t, err)
+	assert.Equal(t, admissionregistrationv1.SideEffectClassNone, *result.Webhooks[0].SideEffects)
+	assert.Equal(t, admissionregistrationv1.Ignore, *result.Webhooks[0].FailurePolicy)
+	assert.Nil(t, result.Webhooks[0].TimeoutSeconds)
+}
+
+func TestRegisterInvalidWebhookFields(t *testing.T) {
+	manager := newTestManager()
+	timeout := int32(31)
+
+	for name, opts := range map[string]mutating.WebhookOptions{
+		"sideEffects":        {SideEffects: admissionregistrationv1.SideEffectClassSome},
+		"failurePolicy":      {FailurePolicy: "Retry"},
+		"timeoutSeconds":     {TimeoutSeconds: &timeout},
+		"matchPolicy":        {MatchPolicy: "Loose"},
+		"reinvocationPolicy": {ReinvocationPolicy: "Always"},
+		"matchConditions": {MatchConditions: []admissionregistrationv1.MatchCondition{
+			{Name: "a", Expression: "true"}, {Name: "a", Expression: "false"},
+		}},
+	} {
+		_, err := manager.Register(mutating.RequestAddRulesBody{Name: "invalid", Options: opts})
+		assert.True(t, errors.Is(err, mutating.ErrInvalidRequest), name)
+	}
+}
+
+func TestRequestAddRulesBodyJSON(t *testing.T) {
+	data := []byte(`{"name":"injectors","webhooks":[` +
+		`{"name":"security","failurePolicy":"Fail","reinvocationPolicy":"IfNeeded"},` +
+		`{"name":"telemetry","endpoint":"otel","timeoutSeconds":3}]}`)
+
+	var req mutating.RequestAddRulesBody
+	assert.NoError(t, json.Unmarshal(data, &req))
+	assert.Equal(t, "injectors", req.Name)
+	assert.Len(t, req.Webhooks, 2)
+	assert.Equal(t, "security", req.Webhooks[0].Name)
+	assert.Equal(t, admissionregistrationv1.Fail, req.Webhooks[0].Options.FailurePolicy)
+	assert.Equal(t, admissionregistrationv1.IfNeededReinvocationPolicy, req.Webhooks[0].Options.ReinvocationPolicy)
+	assert.Equal(t, "otel", req.Webhooks[1].Endpoint)
+	assert.Equal(t, int32(3), *req.Webhooks[1].Options.TimeoutSeconds)
+
+	// The options stay inlined when encoded
+	encoded, err := json.Marshal(req)
+	assert.NoError(t, err)
+	var decoded mutating.RequestAddRulesBody
+	assert.NoError(t, json.Unmarshal(encoded, &decoded))
+	assert.Equal(t, req, decoded)
+	assert.Contains(t, string(encoded), `"failurePolicy":"Fail"`)
+}
+
+func TestRegisterWebhooks(t *testing.T) {
+	manager := newTestManager()
+	timeout := int32(3)
+
+	req := mutating.RequestAddRulesBody{
+		Name: "injectors",
+		Webhooks: []mutating.Webhook{
+			{Name: "security", Options: mutating.WebhookOptions{FailurePolicy: admissionregistrationv1.Fail}},
+			{Name: "telemetry", Endpoint: "otel", Options: mutating.WebhookOptions{TimeoutSeconds: &timeout}},
+		},
+	}
+
+	result, err := manager.Register(req)
+	assert.NoError(t, err)
+	assert.Len(t, result.Webhooks, 2)
+	assert.Equal(t, "security.injectors.admission.webhook", result.Webhooks[0].Name)
+	assert.Equal(t, "https://webhook.example.com:8443/patch/security/trigger", *result.Webhooks[0].ClientConfig.URL)
+	assert.Equal(t, admissionregistrationv1.Fail, *result.Webhooks[0].FailurePolicy)
+	assert.Equal(t, "telemetry.injectors.admission.webhook", result.Webhooks[1].Name)
+	assert.Equal(t, "https://webhook.example.com:8443/patch/otel/trigger", *result.Webhooks[1].ClientConfig.URL)
+	assert.Equal(t, admissionregistrationv1.Ignore, *result.Webhooks[1].FailurePolicy)
+
+	// Updating the group replaces every webhook and keeps the new order
+	req.Webhooks = []mutating.Webhook{req.Webhooks[1], req.Webhooks[0]}
+	_, err = manager.Register(req)
+	assert.NoError(t, err)
+
+	stored, err := manager.Get("injectors")
+	assert.NoError(t, err)
+	assert.Equal(t, "telemetry.injectors.admission.webhook", stored.Webhooks[0].Name)
+	assert.Equal(t, "security.injectors.admission.webhook", stored.Webhooks[1].Name)
+
+	assert.NoError(t, manager.Delete("injectors"))
+	_, err = manager.Get("injectors")
+	assert.Error(t, err)
+}
+
+func TestRegisterInvalidWebhooks(t *testing.T) {
+	manager := newTestManager()
+
+	for name, req := range map[string]mutating.RequestAddRulesBody{
+		"duplicate": {Webhooks: []mutating.Webhook{{Name: "a"}, {Name: "a"}}},
+		"name":      {Webhooks: []mutating.Webhook{{Name: "A.b"}}},
+		"mixed": {
+			Options:  mutating.WebhookOptions{MatchPolicy: admissionregistrationv1.Exact},
+			Webhooks: []mutating.Webhook{{Name: "a"}},
+		},
+		"options": {Webhooks: []mutating.Webhook{{Name: "a", Options: mutating.WebhookOptions{MatchPolicy: "Loose"}}}},
+	} {
+		req.Name = "invalid"
+		_, err := manager.Register(req)
+		assert.True(t, errors.Is(err, mutating.ErrInvalidRequest), name)
+	}
+}
+
+func TestRegisterServiceClientConfig(t *testing.T) {
+	port := int32(443)
+	manager := mutating.NewMutateManager(&mutating.MutatingConfig{
+		Client:           fake.NewSimpleClientset(),
+		AdmissionVersion: []string{"v1"},
+		URL:              "https://webhook.example.com:8443",
+		Service:          &admissionregistrationv1.ServiceReference{Namespace: "webhook", Name: "webhook-svc", Port: &port},
+		FailurePolicy:    admissionregistrationv1.Ignore,
+	})
+
+	result, err := manager.Register(mutating.RequestAddRulesBody{Name: "sidecar"})
+	assert.NoError(t, err)
+
+	clientConfig := result.Webhooks[0].ClientConfig
+	assert.Nil(t, clientConfig.URL)
+	assert.Equal(t, "webhook", clientConfig.Service.Namespace)
+	assert.Equal(t, "webhook-svc", clientConfig.Service.Name)
+	assert.Equal(t, int32(443), *clientConfig.Service.Port)
+	assert.Equal(t, "/patch/sidecar/trigger", *clientConfig.Service.Path)
+}
+
+func TestSyncCABundle(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	manager := mutating.NewMutateManager(&mutating.MutatingConfig{
+		Client:           client,
+		AdmissionVersion: []string{"v1"},
+		URL:              "https://webhook.example.com:8443",
+		FailurePolicy:    admissionregistrationv1.Ignore,
+		ManagedBy:        "sidecar-injector",
+	})
+
+	for _, name := range []string{"sidecar", "telemetry"} {
+		_, err := manager.Register(mutating.RequestAddRulesBody{Name: name})
+		assert.NoError(t, err)
+	}
+
+	// A configuration created by someone else is left alone
+	_, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Create(context.TODO(),
+		&admissionregistrationv1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "foreign"},
+			Webhooks:   []admissionregistrationv1.MutatingWebhook{{Name: "foreign.example.com"}},
+		}, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	updated, err := manager.SyncCABundle(context.TODO(), []byte("rotated-ca"))
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"sidecar", "telemetry"}, updated)
+	assert.Equal(t, []byte("rotated-ca"), manager.CABundle())
+
+	stored, err := manager.Get("telemetry")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("rotated-ca"), stored.Webhooks[0].ClientConfig.CABundle)
+	assert.Equal(t, "sidecar-injector", stored.Labels[mutating.ManagedByLabel])
+
+	foreign, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(context.TODO(), "foreign", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Nil(t, foreign.Webhooks[0].ClientConfig.CABundle)
+
+	// Nothing is updated when the CA bundles are current
+	updated, err = manager.SyncCABundle(context.TODO(), []byte("rotated-ca"))
+	assert.NoError(t, err)
+	assert.Empty(t, updated)
+}
+
+// TestRegisterUnchanged tests that registering the same request again does not update the configuration, once
+// the server has filled in its defaults and metadata.
+func TestRegisterUnchanged(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "mutatingwebhookconfigurations", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		config := action.(k8stesting.CreateAction).GetObject().(*admissionregistrationv1.MutatingWebhookConfiguration)
+		config.UID = "4b4f6a3e"
+		config.Generation = 1
+		for i := range config.Webhooks {
+			webhook := &config.Webhooks[i]
+			timeout, matchPolicy, reinvocation := int32(10), admissionregistrationv1.Equivalent, admissionregistrationv1.NeverReinvocationPolicy
+			webhook.TimeoutSeconds, webhook.MatchPolicy, webhook.ReinvocationPolicy = &timeout, &matchPolicy, &reinvocation
+			webhook.NamespaceSelector, webhook.ObjectSelector = &metav1.LabelSelector{}, &metav1.LabelSelector{}
+			for j := range webhook.Rules {
+				scope := admissionregistrationv1.AllScopes
+				webhook.Rules[j].Scope = &scope
+			}
+		}
+		return false, nil, nil
+	})
+
+	manager := mutating.NewMutateManager(&mutating.MutatingConfig{
+		Client:           client,
+		AdmissionVersion: []string{"v1"},
+		URL:              "https://webhook.example.com:8443",
+		FailurePolicy:    admissionregistrationv1.Ignore,
+	})
+	req := mutating.RequestAddRulesBody{
+		Name: "sidecar",
+		Options: mutating.WebhookOptions{
+			Rules: []mutating.Rule{{
+				APIGroups: []string{""}, APIVersions: []string{"v1"}, Resources: []string{"pods"}, Operations: []string{"CREATE"},
+			}},
+		},
+	}
+
+	_, err := manager.Register(req)
+	assert.NoError(t, err)
+	_, err = manager.Register(req)
+	assert.NoError(t, err)
+
+	for _, action := range client.Actions() {
+		assert.NotEqual(t, "update", action.GetVerb())
+	}
+
+	// A changed request is still applied
+	timeout := int32(5)
+	req.Options.TimeoutSeconds = &timeout
+	result, err := manager.Register(req)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(5), *result.Webhooks[0].TimeoutSeconds)
+}
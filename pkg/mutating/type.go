@@ -1,23 +1,59 @@
 package mutating
 
-import admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+import (
+	"github.com/chungeun-choi/webhook/pkg/webhookconfig"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
 
-type Rule struct {
-	APIGroups   []string `json:"apiGroup"`
-	APIVersions []string `json:"apiVersion"`
-	Resources   []string `json:"resource"`
-	Operations  []string `json:"operations"`
-}
+// ErrInvalidRequest is returned when the webhook configuration requested is invalid
+var ErrInvalidRequest = webhookconfig.ErrInvalidRequest
+
+type Rule = webhookconfig.Rule
+
+// ManagedByLabel marks the configurations registered by the server
+const ManagedByLabel = webhookconfig.ManagedByLabel
+
+// DefaultManagedBy is the value of the ManagedByLabel when the config has none
+const DefaultManagedBy = webhookconfig.DefaultManagedBy
 
 type RequestAddRuleBody struct {
 	Rule Rule `json:"rule"`
 }
 
-type RequestAddRulesBody struct {
-	Name  string `json:"name"`
-	Rules []Rule `json:"rules"`
+// WebhookOptions are the rules, selectors and admission settings of a single webhook
+type WebhookOptions struct {
+	Rules              []Rule                                         `json:"rules"`
+	NamespaceSelector  *metav1.LabelSelector                          `json:"namespaceSelector,omitempty"`
+	ObjectSelector     *metav1.LabelSelector                          `json:"objectSelector,omitempty"`
+	SideEffects        admissionregistrationv1.SideEffectClass        `json:"sideEffects,omitempty"`   // None when empty
+	FailurePolicy      admissionregistrationv1.FailurePolicyType      `json:"failurePolicy,omitempty"` // the failure policy of app.yml when empty
+	TimeoutSeconds     *int32                                         `json:"timeoutSeconds,omitempty"`
+	MatchPolicy        admissionregistrationv1.MatchPolicyType        `json:"matchPolicy,omitempty"`
+	ReinvocationPolicy admissionregistrationv1.ReinvocationPolicyType `json:"reinvocationPolicy,omitempty"`
+	MatchConditions    []admissionregistrationv1.MatchCondition       `json:"matchConditions,omitempty"`
 }
 
+// options returns the options shared with validating webhooks
+func (o WebhookOptions) options() webhookconfig.Options {
+	return webhookconfig.Options{
+		Rules:             o.Rules,
+		NamespaceSelector: o.NamespaceSelector,
+		ObjectSelector:    o.ObjectSelector,
+		SideEffects:       o.SideEffects,
+		FailurePolicy:     o.FailurePolicy,
+		TimeoutSeconds:    o.TimeoutSeconds,
+		MatchPolicy:       o.MatchPolicy,
+		MatchConditions:   o.MatchConditions,
+	}
+}
+
+// Webhook is one webhook of a configuration holding several, calling a patch endpoint
+type Webhook = webhookconfig.Webhook[WebhookOptions]
+
+// RequestAddRulesBody registers a configuration whose webhooks call patch endpoints
+type RequestAddRulesBody = webhookconfig.Request[WebhookOptions]
+
 type ResponseBody struct {
 	Message string `json:"message"`
 }
@@ -0,0 +1,23 @@
+package mutating
+
+import (
+	"fmt"
+
+	"github.com/chungeun-choi/webhook/pkg/webhookconfig"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+)
+
+// validateOptions checks the options shared with validating webhooks and the reinvocation policy of a mutating one
+func validateOptions(opts WebhookOptions) error {
+	if err := webhookconfig.ValidateOptions(opts.options()); err != nil {
+		return err
+	}
+
+	switch opts.ReinvocationPolicy {
+	case "", admissionregistrationv1.NeverReinvocationPolicy, admissionregistrationv1.IfNeededReinvocationPolicy:
+	default:
+		return fmt.Errorf("reinvocationPolicy must be Never or IfNeeded, not %q", opts.ReinvocationPolicy)
+	}
+
+	return nil
+}
@@ -0,0 +1,483 @@
+package patch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// StoreLabel selects the shards of a ConfigMapStore, its value is the name of the store
+	StoreLabel = "webhook.patch/store"
+	// DefaultMaxShardSize is the size of the data of a shard above which a new shard is used, below the 1 MiB
+	// limit of a ConfigMap to leave room for its metadata
+	DefaultMaxShardSize = 900 * 1024
+	// DefaultStoreTimeout is how long a read or write of the ConfigMapStore may take
+	DefaultStoreTimeout = 30 * time.Second
+)
+
+const (
+	// hashedKeyPrefix prefixes the key of an endpoint that is not a valid ConfigMap key
+	hashedKeyPrefix = "endpoint-"
+	// templatePathsSuffix suffixes the name of the ConfigMap holding the pod template paths, which never collides
+	// with the numbered shards
+	templatePathsSuffix = "-template-paths"
+	// templatePathsKey is the key of the pod template paths in their ConfigMap
+	templatePathsKey = "templatePaths"
+)
+
+// configMapRecord is a patch set stored under a key of a shard. The generation grows on every save, so the latest
+// record wins when a patch set being moved to another shard is briefly stored in both.
+type configMapRecord struct {
+	Endpoint   string   `json:"endpoint"`
+	Generation int64    `json:"generation"`
+	Objects    []Object `json:"objects"`
+}
+
+// ConfigMapStore is a Store keeping the patch sets in ConfigMaps of a namespace, so every replica of the server
+// serves the same patch sets. Each patch set is a key of a shard ConfigMap named <name>-<index>, and a new shard
+// is created once the others are full. The pod template paths are kept in the ConfigMap <name>-template-paths. Writes are conditional on the resourceVersion of the shards they read and
+// retried on conflict, so concurrent writes of several replicas never overwrite each other.
+type ConfigMapStore struct {
+	Client       kubernetes.Interface
+	Namespace    string
+	Name         string
+	MaxShardSize int           // DefaultMaxShardSize when zero
+	Timeout      time.Duration // DefaultStoreTimeout when zero
+}
+
+// Load returns the patch sets of every shard
+func (s *ConfigMapStore) Load() ([]PatchBase, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	shards, err := s.listShards(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.decodeShards(shards), nil
+}
+
+// Update persists the patch set update returns from the latest stored one into the shard holding it, or the first
+// shard with room for it. update runs again on the patch set written by another replica whenever the write
+// conflicts with it.
+func (s *ConfigMapStore) Update(endpoint string, update func(current []Object) ([]Object, error)) error {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	key := recordKey(endpoint)
+
+	return s.retry(func() error {
+		shards, err := s.listShards(ctx)
+		if err != nil {
+			return err
+		}
+
+		var (
+			holders    []*corev1.ConfigMap
+			generation int64
+			current    []Object
+		)
+		for _, shard := range shards {
+			if value, ok := shard.Data[key]; ok {
+				holders = append(holders, shard)
+				if record, err := decodeRecord(value); err == nil && record.Generation > generation {
+					generation, current = record.Generation, record.Objects
+				}
+			}
+		}
+
+		objects, err := update(current)
+		if err != nil {
+			return err
+		}
+
+		value, err := json.Marshal(configMapRecord{Endpoint: endpoint, Generation: generation + 1, Objects: objects})
+		if err != nil {
+			return fmt.Errorf("failed to encode the patch set of %s: %w", endpoint, err)
+		}
+		if len(key)+len(value) > s.maxShardSize() {
+			return fmt.Errorf("patch set of %s is %d bytes, more than the %d bytes of a shard", endpoint, len(value), s.maxShardSize())
+		}
+
+		target := s.targetShard(shards, holders, key, len(value))
+		if target == nil {
+			if target, err = s.createShard(ctx, shards, key, string(value)); err != nil {
+				return err
+			}
+		} else {
+			target.Data[key] = string(value)
+			if _, err = s.Client.CoreV1().ConfigMaps(s.Namespace).Update(ctx, target, metav1.UpdateOptions{}); err != nil {
+				return err
+			}
+		}
+
+		// The record moved to another shard, it is removed from the previous one only once stored in the new one
+		for _, holder := range holders {
+			if holder.Name != target.Name {
+				if err = s.removeKey(ctx, holder, key); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// Delete removes the patch set of the endpoint from every shard holding it
+func (s *ConfigMapStore) Delete(endpoint string) error {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	key := recordKey(endpoint)
+
+	return s.retry(func() error {
+		shards, err := s.listShards(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, shard := range shards {
+			if _, ok := shard.Data[key]; ok {
+				if err = s.removeKey(ctx, shard, key); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// LoadTemplatePaths returns the pod template paths of the store
+func (s *ConfigMapStore) LoadTemplatePaths() ([]TemplatePath, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	configMap, err := s.Client.CoreV1().ConfigMaps(s.Namespace).Get(ctx, s.templatePathsName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the pod template paths of the patch store %s: %w", s.Name, err)
+	}
+
+	return decodeTemplatePaths(configMap)
+}
+
+// UpdateTemplatePaths persists the pod template paths update returns from the latest stored ones. update runs again
+// on the pod template paths written by another replica whenever the write conflicts with it.
+func (s *ConfigMapStore) UpdateTemplatePaths(update func(current []TemplatePath) ([]TemplatePath, error)) error {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	client := s.Client.CoreV1().ConfigMaps(s.Namespace)
+
+	return s.retry(func() error {
+		configMap, err := client.Get(ctx, s.templatePathsName(), metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			configMap, err = nil, nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var current []TemplatePath
+		if configMap != nil {
+			if current, err = decodeTemplatePaths(configMap); err != nil {
+				return err
+			}
+		}
+
+		entries, err := update(current)
+		if err != nil {
+			return err
+		}
+		value, err := json.Marshal(entries)
+		if err != nil {
+			return fmt.Errorf("failed to encode the pod template paths: %w", err)
+		}
+
+		if configMap == nil {
+			configMap = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      s.templatePathsName(),
+					Namespace: s.Namespace,
+					Labels:    map[string]string{StoreLabel: s.Name},
+				},
+				Data: map[string]string{templatePathsKey: string(value)},
+			}
+			_, err = client.Create(ctx, configMap, metav1.CreateOptions{})
+			return err
+		}
+
+		if configMap.Data == nil {
+			configMap.Data = make(map[string]string)
+		}
+		configMap.Data[templatePathsKey] = string(value)
+		_, err = client.Update(ctx, configMap, metav1.UpdateOptions{})
+
+		return err
+	})
+}
+
+// Watch follows the shards through an informer and calls onChange with every patch set whenever a shard changes,
+// until the context is done. The patch sets are reported once the shards are listed, and never from a partial list.
+func (s *ConfigMapStore) Watch(ctx context.Context, onChange func(patchSets []PatchBase)) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(s.Client, 0,
+		informers.WithNamespace(s.Namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = s.selector().String()
+		}),
+	)
+	informer := factory.Core().V1().ConfigMaps()
+
+	var synced atomic.Bool
+	notify := func() {
+		if !synced.Load() {
+			return
+		}
+
+		shards, err := informer.Lister().ConfigMaps(s.Namespace).List(labels.Everything())
+		if err != nil {
+			log.Printf("Failed to list the shards of the patch store %s: %v", s.Name, err)
+			return
+		}
+		onChange(s.decodeShards(shards))
+	}
+
+	_, err := informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { notify() },
+		UpdateFunc: func(interface{}, interface{}) { notify() },
+		DeleteFunc: func(interface{}) { notify() },
+	})
+	if err != nil {
+		return fmt.Errorf("failed to watch the patch store %s: %w", s.Name, err)
+	}
+
+	factory.Start(ctx.Done())
+	defer factory.Shutdown()
+
+	if !cache.WaitForCacheSync(ctx.Done(), informer.Informer().HasSynced) {
+		return fmt.Errorf("failed to sync the shards of the patch store %s", s.Name)
+	}
+	synced.Store(true)
+	notify()
+
+	<-ctx.Done()
+	return nil
+}
+
+// targetShard returns the shard the record of the key is written to, or nil when a new shard is needed. The shard
+// already holding the record is kept while the new record fits in it.
+func (s *ConfigMapStore) targetShard(shards, holders []*corev1.ConfigMap, key string, size int) *corev1.ConfigMap {
+	if len(holders) > 0 {
+		holder := holders[0]
+		if shardSize(holder)-len(holder.Data[key])+size <= s.maxShardSize() {
+			return holder
+		}
+	}
+
+	for _, shard := range shards {
+		if _, ok := shard.Data[key]; !ok && shardSize(shard)+len(key)+size <= s.maxShardSize() {
+			return shard
+		}
+	}
+
+	return nil
+}
+
+// createShard creates a shard holding the record, named after the first unused index
+func (s *ConfigMapStore) createShard(ctx context.Context, shards []*corev1.ConfigMap, key, value string) (*corev1.ConfigMap, error) {
+	used := make(map[string]struct{}, len(shards))
+	for _, shard := range shards {
+		used[shard.Name] = struct{}{}
+	}
+
+	name := ""
+	for i := 0; ; i++ {
+		name = s.Name + "-" + strconv.Itoa(i)
+		if _, ok := used[name]; !ok {
+			break
+		}
+	}
+
+	shard := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: s.Namespace,
+			Labels:    map[string]string{StoreLabel: s.Name},
+		},
+		Data: map[string]string{key: value},
+	}
+
+	created, err := s.Client.CoreV1().ConfigMaps(s.Namespace).Create(ctx, shard, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Created the shard %s/%s of the patch store", s.Namespace, name)
+
+	return created, nil
+}
+
+// removeKey removes the key from the shard, conditional on the resourceVersion of the shard
+func (s *ConfigMapStore) removeKey(ctx context.Context, shard *corev1.ConfigMap, key string) error {
+	delete(shard.Data, key)
+	_, err := s.Client.CoreV1().ConfigMaps(s.Namespace).Update(ctx, shard, metav1.UpdateOptions{})
+
+	return err
+}
+
+// listShards returns the shards of the store sorted by name
+func (s *ConfigMapStore) listShards(ctx context.Context) ([]*corev1.ConfigMap, error) {
+	list, err := s.Client.CoreV1().ConfigMaps(s.Namespace).List(ctx, metav1.ListOptions{LabelSelector: s.selector().String()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the shards of the patch store %s: %w", s.Name, err)
+	}
+
+	shards := make([]*corev1.ConfigMap, 0, len(list.Items))
+	for i := range list.Items {
+		shard := &list.Items[i]
+		if shard.Name == s.templatePathsName() {
+			continue
+		}
+		if shard.Data == nil {
+			shard.Data = make(map[string]string)
+		}
+		shards = append(shards, shard)
+	}
+	sort.Slice(shards, func(i, j int) bool { return shards[i].Name < shards[j].Name })
+
+	return shards, nil
+}
+
+// decodeShards returns the patch sets of the shards sorted by endpoint, keeping the latest record of an endpoint
+// stored in several shards. Records that cannot be decoded are skipped.
+func (s *ConfigMapStore) decodeShards(shards []*corev1.ConfigMap) []PatchBase {
+	records := make(map[string]configMapRecord)
+	for _, shard := range shards {
+		if shard.Name == s.templatePathsName() {
+			continue
+		}
+		for key, value := range shard.Data {
+			record, err := decodeRecord(value)
+			if err != nil {
+				log.Printf("Failed to decode the patch set %s of %s/%s: %v", key, shard.Namespace, shard.Name, err)
+				continue
+			}
+
+			if current, ok := records[record.Endpoint]; !ok || record.Generation > current.Generation {
+				records[record.Endpoint] = record
+			}
+		}
+	}
+
+	patchSets := make([]PatchBase, 0, len(records))
+	for _, record := range records {
+		patchSets = append(patchSets, PatchBase{EndpointPath: record.Endpoint, Objects: record.Objects})
+	}
+	sort.Slice(patchSets, func(i, j int) bool { return patchSets[i].EndpointPath < patchSets[j].EndpointPath })
+
+	return patchSets
+}
+
+// retry runs the write again when it lost a race with another replica
+func (s *ConfigMapStore) retry(write func() error) error {
+	return retry.OnError(retry.DefaultRetry, func(err error) bool {
+		return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)
+	}, write)
+}
+
+// templatePathsName returns the name of the ConfigMap holding the pod template paths
+func (s *ConfigMapStore) templatePathsName() string {
+	return s.Name + templatePathsSuffix
+}
+
+func (s *ConfigMapStore) selector() labels.Selector {
+	return labels.SelectorFromSet(labels.Set{StoreLabel: s.Name})
+}
+
+func (s *ConfigMapStore) context() (context.Context, context.CancelFunc) {
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = DefaultStoreTimeout
+	}
+
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+func (s *ConfigMapStore) maxShardSize() int {
+	if s.MaxShardSize == 0 {
+		return DefaultMaxShardSize
+	}
+
+	return s.MaxShardSize
+}
+
+// recordKey returns the key of the endpoint in a shard, the endpoint itself when it is a valid ConfigMap key
+func recordKey(endpoint string) string {
+	if len(validation.IsConfigMapKey(endpoint)) == 0 && !strings.HasPrefix(endpoint, hashedKeyPrefix) {
+		return endpoint
+	}
+
+	sum := sha256.Sum256([]byte(endpoint))
+	return hashedKeyPrefix + hex.EncodeToString(sum[:16])
+}
+
+// decodeRecord decodes the record stored under a key of a shard
+func decodeRecord(value string) (configMapRecord, error) {
+	var record configMapRecord
+	if err := json.Unmarshal([]byte(value), &record); err != nil {
+		return record, err
+	}
+	if record.Endpoint == "" {
+		return record, fmt.Errorf("record has no endpoint")
+	}
+
+	return record, nil
+}
+
+// decodeTemplatePaths decodes the pod template paths stored in their ConfigMap
+func decodeTemplatePaths(configMap *corev1.ConfigMap) ([]TemplatePath, error) {
+	value, ok := configMap.Data[templatePathsKey]
+	if !ok {
+		return nil, nil
+	}
+
+	var entries []TemplatePath
+	if err := json.Unmarshal([]byte(value), &entries); err != nil {
+		return nil, fmt.Errorf("failed to decode the pod template paths of %s/%s: %w", configMap.Namespace, configMap.Name, err)
+	}
+
+	return entries, nil
+}
+
+// shardSize returns the size of the data of the shard
+func shardSize(shard *corev1.ConfigMap) int {
+	size := 0
+	for key, value := range shard.Data {
+		size += len(key) + len(value)
+	}
+
+	return size
+}
@@ -0,0 +1,149 @@
+package patch_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/chungeun-choi/webhook/pkg/patch"
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newConfigMapStore(client *fake.Clientset, maxShardSize int) *patch.ConfigMapStore {
+	return &patch.ConfigMapStore{
+		Client:       client,
+		Namespace:    "webhook-system",
+		Name:         "webhook-patches",
+		MaxShardSize: maxShardSize,
+	}
+}
+
+// replaceWith returns an update replacing the patch set with the objects
+func replaceWith(objects []patch.Object) func([]patch.Object) ([]patch.Object, error) {
+	return func([]patch.Object) ([]patch.Object, error) { return objects, nil }
+}
+
+// listShards returns the names of the shards of the store
+func listShards(t *testing.T, client *fake.Clientset) []string {
+	list, err := client.CoreV1().ConfigMaps("webhook-system").List(context.TODO(), metav1.ListOptions{
+		LabelSelector: patch.StoreLabel + "=webhook-patches",
+	})
+	assert.NoError(t, err)
+
+	names := make([]string, 0, len(list.Items))
+	for _, item := range list.Items {
+		names = append(names, item.Name)
+	}
+
+	return names
+}
+
+// TestConfigMapStoreReplicas tests that a replica converges on the patch sets written by another replica.
+func TestConfigMapStoreReplicas(t *testing.T) {
+	client := fake.NewSimpleClientset()
+
+	first, err := patch.NewPersistentRegistry(newConfigMapStore(client, 0))
+	assert.NoError(t, err)
+	_, err = first.Put("a", testObjects("sidecar"))
+	assert.NoError(t, err)
+
+	store := newConfigMapStore(client, 0)
+	second, err := patch.NewPersistentRegistry(store)
+	assert.NoError(t, err)
+	_, ok := second.Get("a")
+	assert.True(t, ok, "The patch sets should be restored on startup")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = store.Watch(ctx, second.Sync) }()
+
+	_, err = first.Put("b/with/slashes", testObjects("agent"))
+	assert.NoError(t, err)
+	_, err = first.Delete("a")
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		managers := second.List()
+		return len(managers) == 1 && managers[0].Endpoint() == "b/with/slashes"
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, first.List()[0].Plan().Revision(), second.List()[0].Plan().Revision())
+}
+
+// TestConfigMapStoreShards tests that patch sets are spread over shards by size and move when they grow.
+func TestConfigMapStoreShards(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	store := newConfigMapStore(client, 350)
+
+	assert.NoError(t, store.Update("a", replaceWith(testObjects("sidecar"))))
+	assert.NoError(t, store.Update("b", replaceWith(testObjects("sidecar"))))
+	assert.Equal(t, []string{"webhook-patches-0"}, listShards(t, client))
+
+	// The patch set no longer fits next to the other one and moves to a new shard
+	assert.NoError(t, store.Update("a", replaceWith(append(testObjects("sidecar"), testObjects("agent")...))))
+	assert.ElementsMatch(t, []string{"webhook-patches-0", "webhook-patches-1"}, listShards(t, client))
+	shard, err := client.CoreV1().ConfigMaps("webhook-system").Get(context.TODO(), "webhook-patches-0", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.NotContains(t, shard.Data, "a")
+
+	patchSets, err := store.Load()
+	assert.NoError(t, err)
+	if assert.Len(t, patchSets, 2) {
+		assert.Equal(t, "a", patchSets[0].EndpointPath)
+		assert.Len(t, patchSets[0].Objects, 2)
+	}
+
+	err = store.Update("c", replaceWith(make([]patch.Object, 10)))
+	assert.Error(t, err, "A patch set larger than a shard should be rejected")
+}
+
+// TestConfigMapStoreConflict tests that a write losing a race with another replica is retried.
+func TestConfigMapStoreConflict(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	store := newConfigMapStore(client, 0)
+	assert.NoError(t, store.Update("a", replaceWith(testObjects("sidecar"))))
+
+	conflicts := 1
+	client.PrependReactor("update", "configmaps", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts > 0 {
+			conflicts--
+			return true, nil, apierrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, "webhook-patches-0", nil)
+		}
+		return false, nil, nil
+	})
+
+	assert.NoError(t, store.Update("b", replaceWith(testObjects("agent"))))
+	assert.Equal(t, 0, conflicts)
+
+	patchSets, err := store.Load()
+	assert.NoError(t, err)
+	assert.Len(t, patchSets, 2)
+}
+
+// TestConfigMapStoreConcurrentAdd tests that objects added by a replica that has not synced the patch set written
+// by another replica are added to that patch set rather than replacing it.
+func TestConfigMapStoreConcurrentAdd(t *testing.T) {
+	client := fake.NewSimpleClientset()
+
+	first, err := patch.NewPersistentRegistry(newConfigMapStore(client, 0))
+	assert.NoError(t, err)
+	second, err := patch.NewPersistentRegistry(newConfigMapStore(client, 0))
+	assert.NoError(t, err)
+
+	_, err = first.Put("a", testObjects("sidecar"))
+	assert.NoError(t, err)
+	pm, err := second.Add("a", testObjects("agent"))
+	assert.NoError(t, err)
+	assert.Len(t, pm.GetObjects(), 2)
+
+	patchSets, err := newConfigMapStore(client, 0).Load()
+	assert.NoError(t, err)
+	if assert.Len(t, patchSets, 1) {
+		assert.Len(t, patchSets[0].Objects, 2)
+	}
+}
@@ -0,0 +1,261 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+)
+
+// fileStoreVersion is the version of the format of the FileStore file
+const fileStoreVersion = 1
+
+// fileStoreContent is the content of the FileStore file
+type fileStoreContent struct {
+	Version       int            `json:"version"`
+	PatchSets     []PatchBase    `json:"patchSets"`
+	TemplatePaths []TemplatePath `json:"templatePaths,omitempty"`
+}
+
+// FileStore is a Store keeping every patch set in a single JSON file. The file is replaced atomically on every
+// change: the new content is written and synced to a temporary file of the same directory, which is then renamed
+// over the file, so a crash leaves either the previous or the new content and never a partial file. Every change
+// reads the file again, so it never drops the patch sets of a file that was not loaded first.
+type FileStore struct {
+	path string
+
+	mu sync.Mutex
+}
+
+// NewFileStore creates a FileStore for the file, creating its directory if needed
+func NewFileStore(path string) (*FileStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create the directory of the patch store: %w", err)
+	}
+
+	return &FileStore{path: path}, nil
+}
+
+// Load reads the file, a missing file is an empty store. Temporary files left by a crash are removed.
+func (s *FileStore) Load() ([]PatchBase, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeTempFiles()
+
+	content, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+
+	return content.PatchSets, nil
+}
+
+// Update persists the patch set update returns from the persisted one. The file has a single writer, so update
+// runs once.
+func (s *FileStore) Update(endpoint string, update func(current []Object) ([]Object, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	records := recordsOf(content.PatchSets)
+	objects, err := update(records[endpoint])
+	if err != nil {
+		return err
+	}
+	records[endpoint] = objects
+	content.PatchSets = patchSetsOf(records)
+
+	return s.write(content)
+}
+
+// Delete removes the patch set of the endpoint
+func (s *FileStore) Delete(endpoint string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	records := recordsOf(content.PatchSets)
+	if _, ok := records[endpoint]; !ok {
+		return nil
+	}
+	delete(records, endpoint)
+	content.PatchSets = patchSetsOf(records)
+
+	return s.write(content)
+}
+
+// LoadTemplatePaths returns the pod template paths of the file
+func (s *FileStore) LoadTemplatePaths() ([]TemplatePath, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+
+	return content.TemplatePaths, nil
+}
+
+// UpdateTemplatePaths persists the pod template paths update returns from the persisted ones
+func (s *FileStore) UpdateTemplatePaths(update func(current []TemplatePath) ([]TemplatePath, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	if content.TemplatePaths, err = update(content.TemplatePaths); err != nil {
+		return err
+	}
+
+	return s.write(content)
+}
+
+// read returns the content of the file, a missing file is empty. The caller must hold the lock.
+func (s *FileStore) read() (fileStoreContent, error) {
+	content := fileStoreContent{Version: fileStoreVersion}
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return content, nil
+	}
+	if err != nil {
+		return content, fmt.Errorf("failed to read the patch store %s: %w", s.path, err)
+	}
+
+	if err = json.Unmarshal(data, &content); err != nil {
+		return content, fmt.Errorf("failed to decode the patch store %s: %w", s.path, err)
+	}
+	if content.Version != fileStoreVersion {
+		return content, fmt.Errorf("unsupported version %d of the patch store %s", content.Version, s.path)
+	}
+
+	return content, nil
+}
+
+// write replaces the file with the content. The caller must hold the lock.
+func (s *FileStore) write(content fileStoreContent) error {
+	data, err := json.MarshalIndent(content, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode the patch store: %w", err)
+	}
+
+	if err = writeFileAtomic(s.path, data); err != nil {
+		return fmt.Errorf("failed to write the patch store %s: %w", s.path, err)
+	}
+
+	return nil
+}
+
+// recordsOf returns the objects of the patch sets by endpoint
+func recordsOf(patchSets []PatchBase) map[string][]Object {
+	records := make(map[string][]Object, len(patchSets)+1)
+	for _, patchSet := range patchSets {
+		records[patchSet.EndpointPath] = patchSet.Objects
+	}
+
+	return records
+}
+
+// patchSetsOf returns the patch sets of the records sorted by endpoint
+func patchSetsOf(records map[string][]Object) []PatchBase {
+	patchSets := make([]PatchBase, 0, len(records))
+	for endpoint, objects := range records {
+		patchSets = append(patchSets, PatchBase{EndpointPath: endpoint, Objects: objects})
+	}
+	sort.Slice(patchSets, func(i, j int) bool {
+		return patchSets[i].EndpointPath < patchSets[j].EndpointPath
+	})
+
+	return patchSets
+}
+
+// tempPattern is the pattern of the temporary files of the FileStore
+func (s *FileStore) tempPattern() string {
+	return "." + filepath.Base(s.path) + ".*.tmp"
+}
+
+// removeTempFiles removes the temporary files a crash left before they were renamed
+func (s *FileStore) removeTempFiles() {
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(s.path), s.tempPattern()))
+	if err != nil {
+		return
+	}
+
+	for _, match := range matches {
+		if err = os.Remove(match); err != nil {
+			log.Printf("Failed to remove the temporary patch store file %s: %v", match, err)
+		}
+	}
+}
+
+// writeFileAtomic writes the data to a synced temporary file renamed over the file, then syncs the directory so the
+// rename itself survives a crash
+func writeFileAtomic(path string, data []byte) (err error) {
+	dir := filepath.Dir(path)
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+// syncDir syncs the directory entries. Platforms that cannot sync a directory are ignored.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	if err = d.Sync(); err != nil && !isUnsupportedSync(err) {
+		return err
+	}
+
+	return nil
+}
+
+// isUnsupportedSync reports whether syncing a directory failed because the platform does not support it
+func isUnsupportedSync(err error) bool {
+	return errors.Is(err, syscall.EINVAL) || errors.Is(err, syscall.ENOTSUP)
+}
@@ -0,0 +1,130 @@
+package patch_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chungeun-choi/webhook/pkg/patch"
+	"github.com/stretchr/testify/assert"
+)
+
+// failingStore is a Store whose writes fail
+type failingStore struct{}
+
+func (failingStore) Load() ([]patch.PatchBase, error) { return nil, nil }
+func (failingStore) Delete(string) error              { return errors.New("disk full") }
+func (failingStore) Update(string, func([]patch.Object) ([]patch.Object, error)) error {
+	return errors.New("disk full")
+}
+
+func openRegistry(t *testing.T, path string) *patch.Registry {
+	store, err := patch.NewFileStore(path)
+	assert.NoError(t, err)
+
+	registry, err := patch.NewPersistentRegistry(store)
+	assert.NoError(t, err)
+
+	return registry
+}
+
+// TestFileStoreRestore tests that the patch sets are restored by a registry on the same file.
+func TestFileStoreRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "patches.json")
+
+	registry := openRegistry(t, path)
+	_, err := registry.Put("a", testObjects("sidecar"))
+	assert.NoError(t, err)
+	_, err = registry.Add("a", testObjects("agent"))
+	assert.NoError(t, err)
+	_, err = registry.Put("b", testObjects("sidecar"))
+	assert.NoError(t, err)
+	_, err = registry.Delete("b")
+	assert.NoError(t, err)
+
+	// A temporary file left by a crash is ignored and removed
+	temp := filepath.Join(filepath.Dir(path), ".patches.json.123.tmp")
+	assert.NoError(t, os.WriteFile(temp, []byte("{"), 0600))
+
+	restored := openRegistry(t, path)
+	managers := restored.List()
+	if assert.Len(t, managers, 1) {
+		assert.Equal(t, "a", managers[0].Endpoint())
+		assert.Equal(t, registry.List()[0].Plan().Revision(), managers[0].Plan().Revision())
+		assert.Len(t, managers[0].GetObjects(), 2)
+	}
+
+	_, err = os.Stat(temp)
+	assert.True(t, os.IsNotExist(err))
+}
+
+// TestFileStoreDeleteNotLoaded tests that a persisted patch set that no longer compiles can still be deleted.
+func TestFileStoreDeleteNotLoaded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "patches.json")
+	content := `{"version":1,"patchSets":[{"endpoint":"a","objects":[{"op":"add","requestObjectType":"container","targetObjectType":"widget","spec":{}}]}]}`
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+
+	registry := openRegistry(t, path)
+	_, ok := registry.Get("a")
+	assert.False(t, ok)
+
+	deleted, err := registry.Delete("a")
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+	deleted, err = registry.Delete("a")
+	assert.NoError(t, err)
+	assert.False(t, deleted)
+
+	store, err := patch.NewFileStore(path)
+	assert.NoError(t, err)
+	patchSets, err := store.Load()
+	assert.NoError(t, err)
+	assert.Empty(t, patchSets)
+}
+
+// TestFileStoreUpdateBeforeLoad tests that a change on a store that was not loaded keeps the other patch sets.
+func TestFileStoreUpdateBeforeLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "patches.json")
+	_, err := openRegistry(t, path).Put("a", testObjects("sidecar"))
+	assert.NoError(t, err)
+
+	store, err := patch.NewFileStore(path)
+	assert.NoError(t, err)
+	assert.NoError(t, store.Update("b", func([]patch.Object) ([]patch.Object, error) {
+		return testObjects("agent"), nil
+	}))
+
+	patchSets, err := store.Load()
+	assert.NoError(t, err)
+	if assert.Len(t, patchSets, 2) {
+		assert.Equal(t, "a", patchSets[0].EndpointPath)
+		assert.Equal(t, "b", patchSets[1].EndpointPath)
+	}
+}
+
+// TestFileStoreCorrupt tests that a file that cannot be decoded is reported rather than overwritten.
+func TestFileStoreCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "patches.json")
+	assert.NoError(t, os.WriteFile(path, []byte("{"), 0600))
+
+	store, err := patch.NewFileStore(path)
+	assert.NoError(t, err)
+	_, err = patch.NewPersistentRegistry(store)
+	assert.Error(t, err)
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "{", string(data))
+}
+
+// TestRegistryStoreFailure tests that a change the store fails to persist is not applied.
+func TestRegistryStoreFailure(t *testing.T) {
+	registry, err := patch.NewPersistentRegistry(failingStore{})
+	assert.NoError(t, err)
+
+	_, err = registry.Put("a", testObjects("sidecar"))
+	assert.ErrorIs(t, err, patch.ErrStore)
+	_, ok := registry.Get("a")
+	assert.False(t, ok)
+}
@@ -2,94 +2,96 @@ package patch
 
 import (
 	"errors"
+	"fmt"
 	"log"
+	"sync/atomic"
 )
 
-var (
-	ManagerMap map[string]*PatchManager = make(map[string]*PatchManager)
-)
-
+// PatchManager holds the compiled plan of an endpoint. Admission requests only load the current plan, while
+// the Registry compiles a new plan whenever the patch set changes and swaps it in atomically.
 type PatchManager struct {
-	PatchOperations []PatchOperation
+	endpoint string
+	plan     atomic.Pointer[Plan]
 }
 
-func NewPatchManager(name string) *PatchManager {
-	var pm *PatchManager
-	if _, ok := ManagerMap[name]; !ok {
-		pm = &PatchManager{}
-		ManagerMap[name] = pm
-	} else {
-		pm = ManagerMap[name]
-	}
-
-	return pm
+// Endpoint returns the endpoint of the PatchManager
+func (pm *PatchManager) Endpoint() string {
+	return pm.endpoint
 }
 
-// Update updates the patch operations for the PatchManager. it was clear the existing patch operations and add the new ones
-func (pm *PatchManager) UpdatePatchOperation(req RequestPatch) error {
-	// Clear the existing patch operations
-	pm.ClearPatchOperations()
-
-	return pm.AddPatchOperations(req)
+// Plan returns the current plan of the PatchManager
+func (pm *PatchManager) Plan() *Plan {
+	return pm.plan.Load()
 }
 
-// GetPatchOperations returns the patch operations for the PatchManager
-func (pm *PatchManager) GetPatchOperations() []PatchOperation {
-	return pm.PatchOperations
+// GetObjects returns the registered objects for the PatchManager
+func (pm *PatchManager) GetObjects() []Object {
+	return pm.Plan().Objects()
 }
 
-// ClearPatchOperations clears the patch operations for the PatchManager
-func (pm *PatchManager) ClearPatchOperations() {
-	pm.PatchOperations = nil
-}
-
-// AddPatchOperations adds the patch operations to the PatchManager
-func (pm *PatchManager) AddPatchOperations(req RequestPatch) error {
-	for _, obj := range req.Objects {
-		operation, err := convertToPatchOperation(obj)
-		if err != nil {
-			log.Printf("Error: %v", err)
-			return err
-		}
-
-		pm.PatchOperations = append(pm.PatchOperations, *operation)
-	}
-
-	return nil
+// GetPatchOperations returns the patch operations for the PatchManager as they would apply to an object
+// that has no containers, volumes or annotations yet. The operations sent to the API server are rendered
+// by Plan.Render against the admitted object.
+func (pm *PatchManager) GetPatchOperations() []PatchOperation {
+	return pm.Plan().Operations()
 }
 
 // convertToPatchOperation converts the request object to a PatchOperation
 func convertToPatchOperation(info Object) (*PatchOperation, error) {
 	var path string
 
+	if info.Op != OpAdd && info.Op != OpReplace {
+		return nil, fmt.Errorf("unsupported patch operation %q", info.Op)
+	}
+
 	path, err := basePath(info.RequestObjectType, info.TargetObjectType)
 	if err != nil {
 		log.Printf("Error: %v", err)
 		return nil, err
 	}
 
+	if _, ok := info.RequestSpec.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("spec of %s must be an object", info.RequestObjectType)
+	}
+
+	var value interface{} = info.RequestSpec
+	if info.RequestObjectType != POD {
+		value = []interface{}{info.RequestSpec}
+	}
+
 	return &PatchOperation{
-		Op:    info.Op,
+		Op:    OpAdd,
 		Path:  path,
-		Value: info,
+		Value: value,
 	}, nil
 }
 
-// basePath determines the JSON path where the requestObjectType should be added to the targetObjectType
+// basePath determines the JSON path where the requestObjectType should be added to the targetObjectType,
+// using the first pod template of the target object type registered in the DefaultResolver
 func basePath(requestObjectType, targetObjectType string) (string, error) {
-	switch targetObjectType {
-	case DEPLOYMENT, STATEFULSET:
-		switch requestObjectType {
-		case CONTAINER:
-			return "/spec/template/spec/containers", nil
-		case POD:
-			return "/spec/template/spec", nil
-		case VOLUME:
-			return "/spec/template/spec/volumes", nil
-		default:
-			return "", errors.New(" unsupported request object type")
-		}
+	entry, err := DefaultResolver.ResolveTarget(targetObjectType)
+	if err != nil {
+		return "", err
+	}
+
+	path, err := podSpecPath(requestObjectType)
+	if err != nil {
+		return "", err
+	}
+
+	return entry.Paths[0] + "/spec" + path, nil
+}
+
+// podSpecPath determines the JSON path of the requestObjectType relative to the pod spec
+func podSpecPath(requestObjectType string) (string, error) {
+	switch requestObjectType {
+	case CONTAINER:
+		return "/containers", nil
+	case POD:
+		return "", nil
+	case VOLUME:
+		return "/volumes", nil
 	default:
-		return "", errors.New("unsupported target object type")
+		return "", errors.New(" unsupported request object type")
 	}
 }
@@ -5,21 +5,48 @@ import (
 	admissionv1 "k8s.io/api/admission/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"log"
+	"strings"
 )
 
-func Patch(name string) *admissionv1.AdmissionResponse {
+// Patch builds the admission response for the request with the patch set registered for the endpoint
+func (r *Registry) Patch(name string, req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
 	var result *admissionv1.AdmissionResponse = new(admissionv1.AdmissionResponse)
 
-	if patchManager, ok := ManagerMap[name]; !ok {
+	if patchManager, ok := r.Get(name); !ok {
 		result.Result = &metav1.Status{
 			Message: "No patch manager found",
 		}
+	} else if len(req.Object.Raw) == 0 {
+		// A DELETE has no object to patch, it is allowed as it is
+		result.Allowed = true
+		result.Result = &metav1.Status{
+			Message: "No changes: admission request has no object",
+		}
 	} else {
-		// Add an annotation to the object
-		patchManager.PatchOperations = append(patchManager.PatchOperations, createAnnotationPatch())
+		// Render the patch operations against the admitted object
+		rendered, err := patchManager.Plan().Render(req.Object.Raw)
+		if err != nil {
+			log.Printf("Error: %v", err)
+			result.Result = &metav1.Status{
+				Message: err.Error(),
+			}
+
+			return result
+		}
+
+		// Nothing to inject, allow the object as it is and report why
+		if len(rendered.Operations) == 0 {
+			log.Printf("Skipped patch %s for %s/%s: %s", name, req.Namespace, req.Name, strings.Join(rendered.Skipped, "; "))
+			result.Allowed = true
+			result.Result = &metav1.Status{
+				Message: "No changes: " + strings.Join(rendered.Skipped, "; "),
+			}
+
+			return result
+		}
 
 		// Marshal the patch operations
-		data, err := json.Marshal(patchManager.PatchOperations)
+		data, err := json.Marshal(rendered.Operations)
 		if err != nil {
 			log.Printf("Error: %v", err)
 
@@ -28,25 +55,16 @@ func Patch(name string) *admissionv1.AdmissionResponse {
 
 		// Create the admission response
 		result = createAdmissionResponseWithPatch(data)
-		if result.Patch == nil {
+		if len(rendered.Skipped) > 0 {
 			result.Result = &metav1.Status{
-				Message: "No patch data",
+				Message: "Skipped: " + strings.Join(rendered.Skipped, "; "),
 			}
 		}
-
 	}
 
 	return result
 }
 
-func createAnnotationPatch() PatchOperation {
-	return PatchOperation{
-		Op:    "add",
-		Path:  "metadata/annotations",
-		Value: map[string]string{admissionWebhookAnnotationStatusKey: "injected"},
-	}
-}
-
 func createAdmissionResponseWithPatch(patchData []byte) *admissionv1.AdmissionResponse {
 	return &admissionv1.AdmissionResponse{
 		Allowed: true,
@@ -0,0 +1,225 @@
+package patch
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Plan is the immutable, precompiled form of the patch set registered for an endpoint. Paths, entry names and
+// the revision are computed once when the plan is compiled, so rendering a plan at admission time only reads it
+// and a plan can be shared by any number of concurrent requests.
+type Plan struct {
+	endpoint string
+	revision string
+	objects  []Object
+	steps    []step
+}
+
+// step is a single precompiled object of the plan
+type step struct {
+	requestObjectType string
+	targetObjectType  string
+	op                string
+	path              string      // path of the request object type relative to the pod spec
+	value             interface{} // spec payload of a container or volume
+	fields            []podField  // sorted spec fields of a pod
+}
+
+// podField is a single field of a pod spec payload
+type podField struct {
+	path   string // path of the field relative to the pod spec
+	value  interface{}
+	values []interface{} // set when the field is an array appended to by the add operation
+}
+
+// Compile validates the objects and compiles them into a plan for the endpoint. Objects failing the typed
+// validation are reported with a ValidationError.
+func Compile(endpoint string, objects []Object) (*Plan, error) {
+	if err := Validate(objects); err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{
+		endpoint: endpoint,
+		objects:  make([]Object, 0, len(objects)),
+		steps:    make([]step, 0, len(objects)),
+	}
+
+	for _, obj := range objects {
+		if obj.Op == "" {
+			obj.Op = OpAdd
+		}
+
+		// Copy the spec so that the plan never shares state with the caller
+		spec, err := copyJSON(obj.RequestSpec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid spec of %s: %w", obj.RequestObjectType, err)
+		}
+		obj.RequestSpec = spec
+
+		// The step keeps the group of the target, so kinds of different groups do not collide
+		target, err := DefaultResolver.ResolveTarget(obj.TargetObjectType)
+		if err != nil {
+			return nil, err
+		}
+
+		path, _ := podSpecPath(obj.RequestObjectType)
+		plan.objects = append(plan.objects, obj)
+		plan.steps = append(plan.steps, compileStep(obj, targetOf(target.Group, target.Kind), path))
+	}
+
+	plan.revision = Revision(plan.objects)
+
+	return plan, nil
+}
+
+// compileStep precompiles a validated object targeting the group-qualified target object type
+func compileStep(obj Object, target, path string) step {
+	s := step{
+		requestObjectType: obj.RequestObjectType,
+		targetObjectType:  target,
+		op:                obj.Op,
+		path:              path,
+		value:             obj.RequestSpec,
+	}
+
+	if obj.RequestObjectType != POD {
+		return s
+	}
+
+	spec := obj.RequestSpec.(map[string]interface{})
+	keys := make([]string, 0, len(spec))
+	for key := range spec {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		field := podField{path: joinPointer("", key), value: spec[key]}
+		if values, ok := spec[key].([]interface{}); ok && obj.Op == OpAdd {
+			field.values = values
+		}
+		s.fields = append(s.fields, field)
+	}
+
+	return s
+}
+
+// copyJSON deep copies a JSON value and normalizes it to the types produced by encoding/json
+func copyJSON(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var out interface{}
+	if err = json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// Endpoint returns the endpoint the plan was compiled for
+func (p *Plan) Endpoint() string {
+	return p.endpoint
+}
+
+// Revision returns the revision of the patch set recorded in the injection annotation
+func (p *Plan) Revision() string {
+	return p.revision
+}
+
+// Objects returns the objects of the plan. The returned slice must not be modified.
+func (p *Plan) Objects() []Object {
+	return p.objects
+}
+
+// Operations returns the patch operations of the plan as they would apply to an object that has no containers,
+// volumes or annotations yet
+func (p *Plan) Operations() []PatchOperation {
+	operations := make([]PatchOperation, 0, len(p.objects))
+	for _, obj := range p.objects {
+		operation, err := convertToPatchOperation(obj)
+		if err != nil {
+			continue
+		}
+
+		operations = append(operations, *operation)
+	}
+
+	return operations
+}
+
+// Render builds the JSON patch that applies the plan to the admitted object. Entries are appended to existing
+// arrays with "/-", missing parents such as metadata.annotations or volumes are created and only the spec
+// payload of each object is used as the value. Pod templates missing from the object, such as an optional
+// component of a custom resource, are skipped rather than created.
+//
+// Objects that carry the injection marker are left untouched, as are containers and volumes whose name
+// already exists, so a reinvocation or an UPDATE does not inject twice.
+func (p *Plan) Render(raw []byte) (*RenderResult, error) {
+	doc, err := decodeDocument(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &renderer{document: doc, result: new(RenderResult)}
+	if revision, ok := doc.injectedRevision(); ok {
+		r.skip("object already carries the injection marker (revision %s)", revision)
+		return r.result, nil
+	}
+
+	// Only the steps targeting the kind of the admitted object apply, at every pod template it embeds
+	resolved, ok := DefaultResolver.Resolve(doc.apiVersion(), doc.kind())
+	if !ok {
+		r.skip("unsupported target object type %q", doc.kind())
+		return r.result, nil
+	}
+	templates := make([]string, 0, len(resolved))
+	for _, template := range resolved {
+		if current, _ := doc.get(template); !isObject(current) {
+			r.skip("pod template %s is not in the object", template)
+			continue
+		}
+		templates = append(templates, template)
+	}
+	gv, _ := schema.ParseGroupVersion(doc.apiVersion())
+	kind := targetOf(gv.Group, doc.kind())
+
+	// Every step adds at least one operation per template, the two annotations come on top
+	r.result.Operations = make([]PatchOperation, 0, len(p.steps)*len(templates)+2)
+	for i := range p.steps {
+		s := &p.steps[i]
+		if s.targetObjectType != kind {
+			r.skip("%s targets %s, not %s", s.requestObjectType, s.targetObjectType, kind)
+			continue
+		}
+
+		for _, template := range templates {
+			path := template + "/spec" + s.path
+			switch s.requestObjectType {
+			case CONTAINER, VOLUME:
+				r.renderListEntry(template, path, s.op, s.value)
+			case POD:
+				r.renderPodSpec(template, path, s.op, s.fields)
+			}
+		}
+	}
+
+	// Nothing was injected, so the object must not be marked either
+	if len(r.result.Operations) == 0 {
+		if len(r.result.Skipped) == 0 {
+			r.skip("patch set has no objects")
+		}
+		return r.result, nil
+	}
+
+	r.renderAnnotation(admissionWebhookAnnotationStatusKey, admissionWebhookStatusInjected)
+	r.renderAnnotation(admissionWebhookAnnotationRevisionKey, p.revision)
+
+	return r.result, nil
+}
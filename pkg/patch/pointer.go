@@ -0,0 +1,138 @@
+package patch
+
+import (
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+var (
+	pointerEscaper   = strings.NewReplacer("~", "~0", "/", "~1")
+	pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+)
+
+// escapePointer escapes a single JSON pointer reference token (RFC 6901)
+func escapePointer(token string) string {
+	return pointerEscaper.Replace(token)
+}
+
+// splitPointer splits a JSON pointer into its unescaped reference tokens
+func splitPointer(pointer string) []string {
+	if pointer == "" || pointer == "/" {
+		return nil
+	}
+
+	tokens := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	for i, token := range tokens {
+		tokens[i] = pointerUnescaper.Replace(token)
+	}
+
+	return tokens
+}
+
+// joinPointer appends escaped reference tokens to a JSON pointer
+func joinPointer(pointer string, tokens ...string) string {
+	var b strings.Builder
+	b.WriteString(strings.TrimSuffix(pointer, "/"))
+	for _, token := range tokens {
+		b.WriteByte('/')
+		b.WriteString(escapePointer(token))
+	}
+
+	return b.String()
+}
+
+// document is a decoded JSON object that tracks the operations rendered against it, so that later
+// operations see the parents and array entries created by earlier ones.
+type document struct {
+	root map[string]interface{}
+}
+
+// get returns the value at the JSON pointer and whether it exists
+func (d *document) get(pointer string) (interface{}, bool) {
+	var cur interface{} = d.root
+	for _, token := range splitPointer(pointer) {
+		switch node := cur.(type) {
+		case map[string]interface{}:
+			next, ok := node[token]
+			if !ok {
+				return nil, false
+			}
+			cur = next
+		case []interface{}:
+			idx, err := strconv.Atoi(token)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return nil, false
+			}
+			cur = node[idx]
+		default:
+			return nil, false
+		}
+	}
+
+	return cur, true
+}
+
+// set records a copy of the value at the JSON pointer, so that values shared with a plan are never modified by
+// later operations. The parent must exist; "-" appends to an array.
+func (d *document) set(pointer string, value interface{}) {
+	d.store(splitPointer(pointer), runtime.DeepCopyJSONValue(value))
+}
+
+// store records the value at the reference tokens without copying it
+func (d *document) store(tokens []string, value interface{}) {
+	if len(tokens) == 0 {
+		if m, ok := value.(map[string]interface{}); ok {
+			d.root = m
+		}
+		return
+	}
+
+	parentTokens := tokens[:len(tokens)-1]
+	parent, ok := d.get(joinPointer("", parentTokens...))
+	if !ok {
+		return
+	}
+
+	last := tokens[len(tokens)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+	case []interface{}:
+		idx, err := strconv.Atoi(last)
+		switch {
+		case last == "-":
+			node = append(node, value)
+		case err == nil && idx >= 0 && idx < len(node):
+			node[idx] = value
+		default:
+			return
+		}
+		// arrays are values, so the grown slice must be stored back into its parent
+		d.store(parentTokens, node)
+	}
+}
+
+// ensure emits "add" operations creating every missing map along the JSON pointer below the root. The root
+// itself must be an object, nothing above it is created. A value that is not an object, such as null, is
+// replaced by an empty map, as "add" replaces an existing member.
+func (d *document) ensure(root, pointer string, ops []PatchOperation) []PatchOperation {
+	if current, _ := d.get(root); !isObject(current) {
+		return ops
+	}
+
+	tokens := splitPointer(pointer)
+	for i := len(splitPointer(root)); i < len(tokens); i++ {
+		cur := joinPointer("", tokens[:i+1]...)
+		if current, _ := d.get(cur); isObject(current) {
+			continue
+		}
+
+		value := map[string]interface{}{}
+		ops = append(ops, PatchOperation{Op: OpAdd, Path: cur, Value: value})
+		d.set(cur, value)
+	}
+
+	return ops
+}
@@ -0,0 +1,82 @@
+package patch
+
+import (
+	"encoding/json"
+	"fmt"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/pmezard/go-difflib/difflib"
+	"sigs.k8s.io/yaml"
+)
+
+// Preview is the outcome of a dry run of a plan against a sample object
+type Preview struct {
+	Patch   []PatchOperation `json:"patch"`
+	Skipped []string         `json:"skipped,omitempty"`
+	Object  json.RawMessage  `json:"object"` // the mutated object
+	Diff    string           `json:"diff"`   // unified diff between the sample and the mutated object in YAML
+}
+
+// Preview renders the plan against a sample object given as JSON or YAML, exactly as an admission request
+// would, applies the patch and returns the patch, the mutated object and a unified diff
+func (p *Plan) Preview(sample []byte) (*Preview, error) {
+	// JSON is a subset of YAML, so both are accepted
+	raw, err := yaml.YAMLToJSON(sample)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the sample object: %w", err)
+	}
+
+	rendered, err := p.Render(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &Preview{
+		Patch:   rendered.Operations,
+		Skipped: rendered.Skipped,
+		Object:  raw,
+	}
+
+	if len(rendered.Operations) > 0 {
+		data, err := json.Marshal(rendered.Operations)
+		if err != nil {
+			return nil, err
+		}
+
+		decoded, err := jsonpatch.DecodePatch(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode the rendered patch: %w", err)
+		}
+
+		if preview.Object, err = decoded.Apply(raw); err != nil {
+			return nil, fmt.Errorf("failed to apply the rendered patch: %w", err)
+		}
+	}
+
+	if preview.Diff, err = diffObjects(raw, preview.Object); err != nil {
+		return nil, err
+	}
+
+	return preview, nil
+}
+
+// diffObjects returns the unified diff between two JSON objects rendered as YAML
+func diffObjects(original, mutated []byte) (string, error) {
+	originalYAML, err := yaml.JSONToYAML(original)
+	if err != nil {
+		return "", err
+	}
+
+	mutatedYAML, err := yaml.JSONToYAML(mutated)
+	if err != nil {
+		return "", err
+	}
+
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(originalYAML)),
+		B:        difflib.SplitLines(string(mutatedYAML)),
+		FromFile: "original",
+		ToFile:   "mutated",
+		Context:  3,
+	})
+}
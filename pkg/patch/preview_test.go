@@ -0,0 +1,89 @@
+package patch_test
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/chungeun-choi/webhook/pkg/patch"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPreview tests the dry run of a plan against the sample manifest.
+func TestPreview(t *testing.T) {
+	sample, err := os.ReadFile("../../test_patch/nginx-deployment.yml")
+	assert.NoError(t, err, "Reading the sample manifest should not produce an error")
+
+	plan, err := patch.Compile("sidecar", testObjects("sidecar"))
+	assert.NoError(t, err, "Compiling should not produce an error")
+
+	preview, err := plan.Preview(sample)
+	assert.NoError(t, err, "Previewing should not produce an error")
+	assert.Equal(t, "/spec/template/spec/containers/-", preview.Patch[0].Path)
+
+	// The mutated object carries the sidecar and the injection marker
+	var mutated struct {
+		Metadata struct {
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+		Spec struct {
+			Template struct {
+				Spec struct {
+					Containers []struct {
+						Name string `json:"name"`
+					} `json:"containers"`
+				} `json:"spec"`
+			} `json:"template"`
+		} `json:"spec"`
+	}
+	assert.NoError(t, json.Unmarshal(preview.Object, &mutated))
+	assert.Len(t, mutated.Spec.Template.Spec.Containers, 2)
+	assert.Equal(t, "sidecar", mutated.Spec.Template.Spec.Containers[1].Name)
+	assert.Equal(t, plan.Revision(), mutated.Metadata.Annotations["sidecar-injector-webhook.morven.me/revision"])
+
+	assert.Contains(t, preview.Diff, "--- original\n+++ mutated\n")
+	assert.Contains(t, preview.Diff, "+      - image: busybox\n+        name: sidecar\n")
+
+	// Previewing the mutated object again changes nothing
+	again, err := plan.Preview(preview.Object)
+	assert.NoError(t, err, "Previewing should not produce an error")
+	assert.Empty(t, again.Patch)
+	assert.Empty(t, again.Diff)
+}
+
+// TestPreviewNullParents tests that parents set to null are replaced rather than patched below.
+func TestPreviewNullParents(t *testing.T) {
+	sample := []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: httpd
+  annotations: null
+spec:
+  template:
+    spec: null
+`)
+
+	plan, err := patch.Compile("sidecar", testObjects("sidecar"))
+	assert.NoError(t, err, "Compiling should not produce an error")
+
+	preview, err := plan.Preview(sample)
+	assert.NoError(t, err, "Previewing should not produce an error")
+
+	var mutated struct {
+		Metadata struct {
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+		Spec struct {
+			Template struct {
+				Spec struct {
+					Containers []struct {
+						Name string `json:"name"`
+					} `json:"containers"`
+				} `json:"spec"`
+			} `json:"template"`
+		} `json:"spec"`
+	}
+	assert.NoError(t, json.Unmarshal(preview.Object, &mutated))
+	assert.Len(t, mutated.Spec.Template.Spec.Containers, 1)
+	assert.Equal(t, plan.Revision(), mutated.Metadata.Annotations["sidecar-injector-webhook.morven.me/revision"])
+}
@@ -0,0 +1,320 @@
+package patch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// ErrStore is returned when a change could not be persisted, the change is then not applied
+	ErrStore = errors.New("failed to persist the patch set")
+	// ErrEmptyEndpoint is returned when a patch set is registered without an endpoint
+	ErrEmptyEndpoint = errors.New("endpoint is required")
+)
+
+// EventType is the type of change made to the registry
+type EventType string
+
+const (
+	EventPut    EventType = "put"
+	EventDelete EventType = "delete"
+)
+
+// Event describes a change made to the registry
+type Event struct {
+	Type     EventType
+	Endpoint string
+	Plan     *Plan // the new plan, nil for EventDelete
+}
+
+// Registry holds the patch managers of every endpoint. Readers load an immutable snapshot of the endpoint map
+// without locking, while writers serialize on a mutex, copy the map and swap the new snapshot in.
+type Registry struct {
+	mu       sync.Mutex // serializes writers and guards watchers
+	managers atomic.Pointer[map[string]*PatchManager]
+	watchers map[*watcher]struct{}
+	store    Store // persists the changes, nil when the patch sets only live in memory
+}
+
+// watcher receives the events of the registry until its context is done
+type watcher struct {
+	ctx    context.Context
+	events chan Event
+}
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	r := &Registry{watchers: make(map[*watcher]struct{})}
+	r.managers.Store(&map[string]*PatchManager{})
+
+	return r
+}
+
+// NewPersistentRegistry creates a Registry persisting its patch sets in the store, restored from the patch sets
+// already in the store. A persisted patch set that no longer compiles, e.g. because a custom resource it targets
+// was removed from the configuration, is kept in the store but not served until it is replaced or deleted.
+func NewPersistentRegistry(store Store) (*Registry, error) {
+	patchSets, err := store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the patch sets: %w", err)
+	}
+
+	r := NewRegistry()
+	for _, patchSet := range patchSets {
+		if _, err = r.update(patchSet.EndpointPath, replace(patchSet.Objects)); err != nil {
+			log.Printf("Failed to restore the patch set of %s: %v", patchSet.EndpointPath, err)
+		}
+	}
+	r.store = store
+
+	return r, nil
+}
+
+// snapshot returns the current endpoint map. The map must not be modified.
+func (r *Registry) snapshot() map[string]*PatchManager {
+	return *r.managers.Load()
+}
+
+// Get returns the patch manager of the endpoint
+func (r *Registry) Get(endpoint string) (*PatchManager, bool) {
+	pm, ok := r.snapshot()[endpoint]
+	return pm, ok
+}
+
+// List returns the patch managers of every endpoint sorted by endpoint
+func (r *Registry) List() []*PatchManager {
+	snapshot := r.snapshot()
+	managers := make([]*PatchManager, 0, len(snapshot))
+	for _, pm := range snapshot {
+		managers = append(managers, pm)
+	}
+	sort.Slice(managers, func(i, j int) bool { return managers[i].endpoint < managers[j].endpoint })
+
+	return managers
+}
+
+// Put replaces the patch set of the endpoint with the objects, creating the endpoint if it does not exist
+func (r *Registry) Put(endpoint string, objects []Object) (*PatchManager, error) {
+	if endpoint == "" {
+		return nil, ErrEmptyEndpoint
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.update(endpoint, replace(objects))
+}
+
+// Add appends the objects to the patch set of the endpoint, creating the endpoint if it does not exist
+func (r *Registry) Add(endpoint string, objects []Object) (*PatchManager, error) {
+	if endpoint == "" {
+		return nil, ErrEmptyEndpoint
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.update(endpoint, func(current []Object) []Object {
+		return append(append(make([]Object, 0, len(current)+len(objects)), current...), objects...)
+	})
+}
+
+// Delete removes the endpoint and reports whether it existed. A patch set persisted in the store but not loaded,
+// because it no longer compiles, is removed from the store as well.
+func (r *Registry) Delete(endpoint string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, loaded := r.snapshot()[endpoint]
+	if r.store == nil {
+		if loaded {
+			r.remove(endpoint)
+		}
+		return loaded, nil
+	}
+
+	stored := loaded
+	if !loaded {
+		var err error
+		if stored, err = r.stored(endpoint); err != nil {
+			return false, fmt.Errorf("%w: %w", ErrStore, err)
+		}
+	}
+	if !stored {
+		return false, nil
+	}
+
+	if err := r.store.Delete(endpoint); err != nil {
+		return false, fmt.Errorf("%w: %w", ErrStore, err)
+	}
+	if loaded {
+		r.remove(endpoint)
+	}
+
+	return true, nil
+}
+
+// stored reports whether the store holds a patch set of the endpoint
+func (r *Registry) stored(endpoint string) (bool, error) {
+	patchSets, err := r.store.Load()
+	if err != nil {
+		return false, err
+	}
+
+	for _, patchSet := range patchSets {
+		if patchSet.EndpointPath == endpoint {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Watch returns a channel receiving every change made to the registry until the context is done. Events are
+// delivered in order and writers wait for the watcher, so a watcher must not call Put, Add or Delete itself.
+func (r *Registry) Watch(ctx context.Context) <-chan Event {
+	w := &watcher{ctx: ctx, events: make(chan Event, 16)}
+
+	r.mu.Lock()
+	r.watchers[w] = struct{}{}
+	r.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		r.mu.Lock()
+		delete(r.watchers, w)
+		close(w.events)
+		r.mu.Unlock()
+	}()
+
+	return w.events
+}
+
+// update compiles the objects update returns from the current patch set of the endpoint, persists them and swaps
+// in the new plan. With a store the current patch set is the persisted one, read and written by the store in one
+// step, so a change made by another replica the registry has not synced yet is not lost. The caller must hold the
+// writer lock.
+func (r *Registry) update(endpoint string, update func(current []Object) []Object) (*PatchManager, error) {
+	if r.store == nil {
+		var current []Object
+		if pm, ok := r.Get(endpoint); ok {
+			current = pm.Plan().Objects()
+		}
+
+		plan, err := Compile(endpoint, update(current))
+		if err != nil {
+			return nil, err
+		}
+		return r.apply(plan), nil
+	}
+
+	var (
+		plan       *Plan
+		compileErr error
+	)
+	err := r.store.Update(endpoint, func(current []Object) ([]Object, error) {
+		if plan, compileErr = Compile(endpoint, update(current)); compileErr != nil {
+			return nil, compileErr
+		}
+		return plan.Objects(), nil
+	})
+	if compileErr != nil {
+		return nil, compileErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrStore, err)
+	}
+
+	return r.apply(plan), nil
+}
+
+// replace returns an update replacing the patch set with the objects
+func replace(objects []Object) func([]Object) []Object {
+	return func([]Object) []Object { return objects }
+}
+
+// apply swaps in the plan. The caller must hold the writer lock.
+func (r *Registry) apply(plan *Plan) *PatchManager {
+	endpoint := plan.Endpoint()
+
+	current := r.snapshot()
+	if pm, ok := current[endpoint]; ok {
+		// Readers holding the manager see the new plan without a new snapshot of the map
+		pm.plan.Store(plan)
+		r.notify(Event{Type: EventPut, Endpoint: endpoint, Plan: plan})
+		return pm
+	}
+
+	pm := &PatchManager{endpoint: endpoint}
+	pm.plan.Store(plan)
+
+	next := make(map[string]*PatchManager, len(current)+1)
+	for k, v := range current {
+		next[k] = v
+	}
+	next[endpoint] = pm
+	r.managers.Store(&next)
+	r.notify(Event{Type: EventPut, Endpoint: endpoint, Plan: plan})
+
+	return pm
+}
+
+// remove swaps out the endpoint. The caller must hold the writer lock.
+func (r *Registry) remove(endpoint string) {
+	current := r.snapshot()
+
+	next := make(map[string]*PatchManager, len(current))
+	for k, v := range current {
+		if k != endpoint {
+			next[k] = v
+		}
+	}
+	r.managers.Store(&next)
+	r.notify(Event{Type: EventDelete, Endpoint: endpoint})
+}
+
+// Sync converges the registry on the patch sets of a store shared with other replicas. Endpoints whose patch set
+// changed are replaced and endpoints missing from the patch sets are removed, without writing back to the store.
+// A patch set that does not compile leaves the endpoint as it is.
+func (r *Registry) Sync(patchSets []PatchBase) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current := r.snapshot()
+	seen := make(map[string]struct{}, len(patchSets))
+	for _, patchSet := range patchSets {
+		seen[patchSet.EndpointPath] = struct{}{}
+
+		plan, err := Compile(patchSet.EndpointPath, patchSet.Objects)
+		if err != nil {
+			log.Printf("Failed to sync the patch set of %s: %v", patchSet.EndpointPath, err)
+			continue
+		}
+
+		if pm, ok := current[patchSet.EndpointPath]; ok && pm.Plan().Revision() == plan.Revision() {
+			continue
+		}
+		r.apply(plan)
+	}
+
+	for endpoint := range current {
+		if _, ok := seen[endpoint]; !ok {
+			r.remove(endpoint)
+		}
+	}
+}
+
+// notify sends the event to every watcher. The caller must hold the writer lock.
+func (r *Registry) notify(event Event) {
+	for w := range r.watchers {
+		select {
+		case w.events <- event:
+		case <-w.ctx.Done():
+		}
+	}
+}
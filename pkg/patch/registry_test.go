@@ -0,0 +1,135 @@
+package patch_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/chungeun-choi/webhook/pkg/patch"
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// testObjects returns a patch set injecting a single container
+func testObjects(name string) []patch.Object {
+	return []patch.Object{
+		{Op: patch.OpAdd, RequestObjectType: patch.CONTAINER, TargetObjectType: patch.DEPLOYMENT, RequestSpec: map[string]interface{}{
+			"name": name, "image": "busybox",
+		}},
+	}
+}
+
+// TestRegistry tests the Put, Add, Get, List and Delete methods of the Registry.
+func TestRegistry(t *testing.T) {
+	registry := patch.NewRegistry()
+
+	_, err := registry.Put("b", testObjects("sidecar"))
+	assert.NoError(t, err, "Putting a patch set should not produce an error")
+	pm, err := registry.Add("a", testObjects("sidecar"))
+	assert.NoError(t, err, "Adding a patch set should not produce an error")
+	_, err = registry.Add("a", testObjects("agent"))
+	assert.NoError(t, err, "Adding a patch set should not produce an error")
+
+	// Managers returned earlier see the new plan
+	assert.Len(t, pm.GetObjects(), 2)
+
+	managers := registry.List()
+	assert.Len(t, managers, 2)
+	assert.Equal(t, "a", managers[0].Endpoint())
+	assert.Equal(t, "b", managers[1].Endpoint())
+
+	// An invalid patch set keeps the current plan
+	_, err = registry.Put("a", []patch.Object{{RequestObjectType: "unknown"}})
+	assert.Error(t, err, "Putting an invalid patch set should produce an error")
+	assert.Len(t, pm.GetObjects(), 2)
+
+	deleted, err := registry.Delete("a")
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+	deleted, err = registry.Delete("a")
+	assert.NoError(t, err)
+	assert.False(t, deleted)
+	_, ok := registry.Get("a")
+	assert.False(t, ok)
+
+	// A patch set must have an endpoint
+	_, err = registry.Put("", nil)
+	assert.ErrorIs(t, err, patch.ErrEmptyEndpoint)
+	_, err = registry.Add("", testObjects("sidecar"))
+	assert.ErrorIs(t, err, patch.ErrEmptyEndpoint)
+}
+
+// TestRegistryPatch tests the admission responses of the patch set of an endpoint.
+func TestRegistryPatch(t *testing.T) {
+	registry := patch.NewRegistry()
+	_, err := registry.Put("a", testObjects("sidecar"))
+	assert.NoError(t, err)
+
+	created := registry.Patch("a", &admissionv1.AdmissionRequest{
+		Operation: admissionv1.Create,
+		Object:    runtime.RawExtension{Raw: []byte(testDeployment)},
+	})
+	assert.True(t, created.Allowed)
+	assert.NotEmpty(t, created.Patch)
+
+	// A DELETE has no object and is allowed without a patch
+	deleted := registry.Patch("a", &admissionv1.AdmissionRequest{
+		Operation: admissionv1.Delete,
+		OldObject: runtime.RawExtension{Raw: []byte(testDeployment)},
+	})
+	assert.True(t, deleted.Allowed)
+	assert.Empty(t, deleted.Patch)
+}
+
+// TestRegistryWatch tests that watchers receive the changes in order.
+func TestRegistryWatch(t *testing.T) {
+	registry := patch.NewRegistry()
+	ctx, cancel := context.WithCancel(context.Background())
+	events := registry.Watch(ctx)
+
+	_, _ = registry.Put("a", testObjects("sidecar"))
+	_, _ = registry.Delete("a")
+
+	event := <-events
+	assert.Equal(t, patch.EventPut, event.Type)
+	assert.Equal(t, "a", event.Endpoint)
+	assert.NotNil(t, event.Plan)
+
+	event = <-events
+	assert.Equal(t, patch.EventDelete, event.Type)
+	assert.Nil(t, event.Plan)
+
+	cancel()
+	_, open := <-events
+	assert.False(t, open, "The channel should be closed when the context is done")
+}
+
+// TestRegistryConcurrent tests that readers and writers can use the Registry concurrently.
+func TestRegistryConcurrent(t *testing.T) {
+	registry := patch.NewRegistry()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		endpoint := fmt.Sprintf("endpoint-%d", i%2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, _ = registry.Put(endpoint, testObjects("sidecar"))
+				_, _ = registry.Delete(endpoint)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if pm, ok := registry.Get(endpoint); ok {
+					_, _ = pm.Plan().Render([]byte(testDeployment))
+				}
+				registry.List()
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,200 @@
+package patch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+const annotationsPath = "/metadata/annotations"
+
+// Render compiles the objects and renders them against the admitted object, see Plan.Render
+func Render(objects []Object, raw []byte) (*RenderResult, error) {
+	plan, err := Compile("", objects)
+	if err != nil {
+		return nil, err
+	}
+
+	return plan.Render(raw)
+}
+
+// Revision returns a stable hash of the objects which identifies the version of the patch set
+func Revision(objects []Object) string {
+	// encoding/json sorts map keys, so equal objects always produce the same bytes
+	data, err := json.Marshal(objects)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// renderer accumulates the operations rendered against the document
+type renderer struct {
+	*document
+	result *RenderResult
+}
+
+func (r *renderer) add(operation PatchOperation) {
+	r.result.Operations = append(r.result.Operations, operation)
+}
+
+func (r *renderer) skip(format string, args ...interface{}) {
+	r.result.Skipped = append(r.result.Skipped, fmt.Sprintf(format, args...))
+}
+
+// decodeDocument decodes the raw admitted object
+func decodeDocument(raw []byte) (*document, error) {
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("admission request has no object")
+	}
+
+	var root map[string]interface{}
+	if err := json.Unmarshal(raw, &root); err != nil {
+		return nil, fmt.Errorf("failed to decode the admitted object: %w", err)
+	}
+
+	return &document{root: root}, nil
+}
+
+// renderListEntry appends the value to the array at path below the pod template root, creating the array when it
+// does not exist. The replace operation overwrites the entry with the same name instead of appending a new one.
+func (r *renderer) renderListEntry(root, path, op string, value interface{}) {
+	r.ensure(root, parentPointer(path))
+
+	current, ok := r.get(path)
+	entries, isArray := current.([]interface{})
+	if !ok || !isArray {
+		entries = []interface{}{value}
+		r.set(path, entries)
+		r.add(PatchOperation{Op: OpAdd, Path: path, Value: entries})
+		return
+	}
+
+	if idx := indexByName(entries, nameOf(value)); idx >= 0 {
+		if op != OpReplace {
+			r.skip("%s already contains %q", path, nameOf(value))
+			return
+		}
+
+		entryPath := fmt.Sprintf("%s/%d", path, idx)
+		r.set(entryPath, value)
+		r.add(PatchOperation{Op: OpReplace, Path: entryPath, Value: value})
+		return
+	}
+
+	r.set(path+"/-", value)
+	r.add(PatchOperation{Op: OpAdd, Path: path + "/-", Value: value})
+}
+
+// renderPodSpec merges the pod spec fields into the pod spec at path below the pod template root. Array fields are
+// appended to for the add operation and every other field is set as a whole.
+func (r *renderer) renderPodSpec(root, path, op string, fields []podField) {
+	r.ensure(root, path)
+
+	for _, field := range fields {
+		fieldPath := path + field.path
+		if field.values != nil {
+			for _, value := range field.values {
+				r.renderListEntry(root, fieldPath, op, value)
+			}
+			continue
+		}
+
+		r.set(fieldPath, field.value)
+		r.add(PatchOperation{Op: OpAdd, Path: fieldPath, Value: field.value})
+	}
+}
+
+// renderAnnotation sets the annotation on the admitted object, creating metadata.annotations when it does not exist
+// or is not an object, such as "annotations: null"
+func (r *renderer) renderAnnotation(key, value string) {
+	r.ensure("", parentPointer(annotationsPath))
+
+	if current, _ := r.get(annotationsPath); !isObject(current) {
+		annotations := map[string]interface{}{key: value}
+		r.set(annotationsPath, annotations)
+		r.add(PatchOperation{Op: OpAdd, Path: annotationsPath, Value: annotations})
+		return
+	}
+
+	path := joinPointer(annotationsPath, key)
+	r.set(path, value)
+	r.add(PatchOperation{Op: OpAdd, Path: path, Value: value})
+}
+
+// ensure creates every missing map along the JSON pointer below the root
+func (r *renderer) ensure(root, pointer string) {
+	r.result.Operations = r.document.ensure(root, pointer, r.result.Operations)
+}
+
+// injectedRevision reports whether the object carries the injection marker and the revision it was injected with
+func (d *document) injectedRevision() (string, bool) {
+	status, _ := d.get(joinPointer(annotationsPath, admissionWebhookAnnotationStatusKey))
+	if status != admissionWebhookStatusInjected {
+		return "", false
+	}
+
+	revision, _ := d.get(joinPointer(annotationsPath, admissionWebhookAnnotationRevisionKey))
+	if revision, ok := revision.(string); ok && revision != "" {
+		return revision, true
+	}
+
+	return "unknown", true
+}
+
+// apiVersion returns the apiVersion of the admitted object
+func (d *document) apiVersion() string {
+	apiVersion, _ := d.root["apiVersion"].(string)
+	return apiVersion
+}
+
+// kind returns the kind of the admitted object
+func (d *document) kind() string {
+	kind, _ := d.root["kind"].(string)
+	return kind
+}
+
+// isObject reports whether the value is a JSON object
+func isObject(value interface{}) bool {
+	_, ok := value.(map[string]interface{})
+	return ok
+}
+
+// parentPointer returns the JSON pointer of the parent of the pointer
+func parentPointer(pointer string) string {
+	tokens := splitPointer(pointer)
+	if len(tokens) == 0 {
+		return ""
+	}
+
+	return joinPointer("", tokens[:len(tokens)-1]...)
+}
+
+// nameOf returns the name field of a container or volume spec
+func nameOf(value interface{}) string {
+	if m, ok := value.(map[string]interface{}); ok {
+		if name, ok := m["name"].(string); ok {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// indexByName returns the index of the entry with the given name, or -1
+func indexByName(entries []interface{}, name string) int {
+	if name == "" {
+		return -1
+	}
+
+	for i, entry := range entries {
+		if nameOf(entry) == name {
+			return i
+		}
+	}
+
+	return -1
+}
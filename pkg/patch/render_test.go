@@ -0,0 +1,187 @@
+package patch_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/chungeun-choi/webhook/pkg/patch"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test data for the admitted deployment
+const testDeployment = `{
+  "apiVersion": "apps/v1",
+  "kind": "Deployment",
+  "metadata": {"name": "httpd-deployment-example", "labels": {"app": "httpd"}},
+  "spec": {
+    "template": {
+      "metadata": {"labels": {"app": "httpd"}},
+      "spec": {"containers": [{"name": "httpd", "image": "httpd:latest"}]}
+    }
+  }
+}`
+
+// TestRender tests that entries are appended to existing arrays and missing parents are created.
+func TestRender(t *testing.T) {
+	sidecar := map[string]interface{}{"name": "sidecar", "image": "busybox"}
+	volume := map[string]interface{}{"name": "data", "emptyDir": map[string]interface{}{}}
+
+	objects := []patch.Object{
+		{Op: patch.OpAdd, RequestObjectType: patch.CONTAINER, TargetObjectType: patch.DEPLOYMENT, RequestSpec: sidecar},
+		{Op: patch.OpAdd, RequestObjectType: patch.VOLUME, TargetObjectType: patch.DEPLOYMENT, RequestSpec: volume},
+		{Op: patch.OpAdd, RequestObjectType: patch.VOLUME, TargetObjectType: patch.DEPLOYMENT, RequestSpec: volume},
+	}
+
+	result, err := patch.Render(objects, []byte(testDeployment))
+	assert.NoError(t, err, "Rendering should not produce an error")
+
+	assert.Equal(t, []patch.PatchOperation{
+		{Op: "add", Path: "/spec/template/spec/containers/-", Value: sidecar},
+		{Op: "add", Path: "/spec/template/spec/volumes", Value: []interface{}{volume}},
+		{Op: "add", Path: "/metadata/annotations", Value: map[string]interface{}{
+			"sidecar-injector-webhook.morven.me/status": "injected",
+		}},
+		{Op: "add", Path: "/metadata/annotations/sidecar-injector-webhook.morven.me~1revision", Value: patch.Revision(objects)},
+	}, result.Operations)
+	assert.Equal(t, []string{`/spec/template/spec/volumes already contains "data"`}, result.Skipped)
+}
+
+// TestRenderPodSpec tests that pod spec fields are merged into the pod template.
+func TestRenderPodSpec(t *testing.T) {
+	container := map[string]interface{}{"name": "sidecar", "image": "busybox"}
+
+	objects := []patch.Object{
+		{Op: patch.OpAdd, RequestObjectType: patch.POD, TargetObjectType: patch.STATEFULSET, RequestSpec: map[string]interface{}{
+			"containers":         []interface{}{container},
+			"serviceAccountName": "injected",
+		}},
+	}
+
+	result, err := patch.Render(objects, []byte(`{"apiVersion": "apps/v1", "kind": "StatefulSet", "metadata": {"annotations": {"a/b": "c"}}, "spec": {"template": {}}}`))
+	assert.NoError(t, err, "Rendering should not produce an error")
+
+	assert.Equal(t, []patch.PatchOperation{
+		{Op: "add", Path: "/spec/template/spec", Value: map[string]interface{}{}},
+		{Op: "add", Path: "/spec/template/spec/containers", Value: []interface{}{container}},
+		{Op: "add", Path: "/spec/template/spec/serviceAccountName", Value: "injected"},
+		{Op: "add", Path: "/metadata/annotations/sidecar-injector-webhook.morven.me~1status", Value: "injected"},
+		{Op: "add", Path: "/metadata/annotations/sidecar-injector-webhook.morven.me~1revision", Value: patch.Revision(objects)},
+	}, result.Operations)
+}
+
+// TestRenderIdempotent tests that injected objects and existing containers are not injected twice.
+func TestRenderIdempotent(t *testing.T) {
+	objects := []patch.Object{
+		{Op: patch.OpAdd, RequestObjectType: patch.CONTAINER, TargetObjectType: patch.DEPLOYMENT, RequestSpec: map[string]interface{}{
+			"name": "httpd", "image": "httpd:latest",
+		}},
+	}
+
+	// The container already exists
+	result, err := patch.Render(objects, []byte(testDeployment))
+	assert.NoError(t, err, "Rendering should not produce an error")
+	assert.Empty(t, result.Operations)
+	assert.Equal(t, []string{`/spec/template/spec/containers already contains "httpd"`}, result.Skipped)
+
+	// The object carries the injection marker
+	result, err = patch.Render(objects, []byte(`{"metadata": {"annotations": {
+		"sidecar-injector-webhook.morven.me/status": "injected",
+		"sidecar-injector-webhook.morven.me/revision": "abc"
+	}}}`))
+	assert.NoError(t, err, "Rendering should not produce an error")
+	assert.Empty(t, result.Operations)
+	assert.Equal(t, []string{"object already carries the injection marker (revision abc)"}, result.Skipped)
+
+	// The revision is stable
+	assert.Equal(t, patch.Revision(objects), patch.Revision(objects))
+	assert.Len(t, patch.Revision(objects), 16)
+}
+
+// TestPlanRender tests that rendering a plan does not modify the plan.
+func TestPlanRender(t *testing.T) {
+	plan, err := patch.Compile("sidecar", []patch.Object{
+		{Op: patch.OpReplace, RequestObjectType: patch.POD, TargetObjectType: patch.DEPLOYMENT, RequestSpec: map[string]interface{}{
+			"volumes": []interface{}{map[string]interface{}{"name": "config", "emptyDir": map[string]interface{}{}}},
+		}},
+		{Op: patch.OpAdd, RequestObjectType: patch.VOLUME, TargetObjectType: patch.DEPLOYMENT, RequestSpec: map[string]interface{}{
+			"name": "data", "emptyDir": map[string]interface{}{},
+		}},
+	})
+	assert.NoError(t, err, "Compiling should not produce an error")
+	objects := plan.Objects()
+
+	first, err := plan.Render([]byte(testDeployment))
+	assert.NoError(t, err, "Rendering should not produce an error")
+	second, err := plan.Render([]byte(testDeployment))
+	assert.NoError(t, err, "Rendering should not produce an error")
+
+	assert.Equal(t, first, second)
+	assert.Equal(t, objects, plan.Objects())
+	assert.Len(t, first.Operations, 4)
+	assert.Equal(t, "/spec/template/spec/volumes/-", first.Operations[1].Path)
+
+	// Invalid objects are rejected when compiling
+	_, err = patch.Compile("sidecar", []patch.Object{{Op: "remove", RequestObjectType: patch.CONTAINER, TargetObjectType: patch.DEPLOYMENT}})
+	assert.Error(t, err, "Compiling an unsupported operation should produce an error")
+}
+
+// TestRenderWorkloadKinds tests that the pod template path is chosen from the kind of the admitted object.
+func TestRenderWorkloadKinds(t *testing.T) {
+	cases := map[string]string{
+		patch.BAREPOD:     "/spec/containers/-",
+		patch.DAEMONSET:   "/spec/template/spec/containers/-",
+		patch.REPLICASET:  "/spec/template/spec/containers/-",
+		patch.JOB:         "/spec/template/spec/containers/-",
+		patch.CRONJOB:     "/spec/jobTemplate/spec/template/spec/containers/-",
+		patch.DEPLOYMENT:  "/spec/template/spec/containers/-",
+		patch.STATEFULSET: "/spec/template/spec/containers/-",
+	}
+	objects := map[string]string{
+		"Pod":        `{"apiVersion": "v1", "kind": "Pod", "metadata": {}, "spec": {"containers": []}}`,
+		"DaemonSet":  `{"apiVersion": "apps/v1", "kind": "DaemonSet", "metadata": {}, "spec": {"template": {"spec": {"containers": []}}}}`,
+		"ReplicaSet": `{"apiVersion": "apps/v1", "kind": "ReplicaSet", "metadata": {}, "spec": {"template": {"spec": {"containers": []}}}}`,
+		"Job":        `{"apiVersion": "batch/v1", "kind": "Job", "metadata": {}, "spec": {"template": {"spec": {"containers": []}}}}`,
+		"CronJob":    `{"apiVersion": "batch/v1", "kind": "CronJob", "metadata": {}, "spec": {"jobTemplate": {"spec": {"template": {"spec": {"containers": []}}}}}}`,
+	}
+
+	for kind, raw := range objects {
+		var objs []patch.Object
+		for target := range cases {
+			objs = append(objs, patch.Object{Op: patch.OpAdd, RequestObjectType: patch.CONTAINER, TargetObjectType: target,
+				RequestSpec: map[string]interface{}{"name": "sidecar-" + target, "image": "busybox"}})
+		}
+
+		result, err := patch.Render(objs, []byte(raw))
+		assert.NoError(t, err, "Rendering %s should not produce an error", kind)
+
+		// Only the object targeting the kind is injected, followed by the two annotations
+		assert.Len(t, result.Operations, 3, "Rendering %s should inject a single container", kind)
+		assert.Equal(t, cases[strings.ToLower(kind)], result.Operations[0].Path)
+	}
+
+	// Kinds without a pod template are left untouched
+	result, err := patch.Render(testObjects("sidecar"), []byte(`{"apiVersion": "v1", "kind": "ConfigMap"}`))
+	assert.NoError(t, err, "Rendering should not produce an error")
+	assert.Empty(t, result.Operations)
+}
+
+// TestRenderMissingTemplate tests that a pod template missing from the object is skipped rather than created.
+func TestRenderMissingTemplate(t *testing.T) {
+	entry := patch.TemplatePath{Group: "example.com", Kind: "Pipeline", Paths: []string{"/spec/a", "/spec/b"}}
+	assert.NoError(t, patch.DefaultResolver.Put(entry))
+	defer func() {
+		_ = patch.DefaultResolver.Delete(entry.Group, entry.Version, entry.Kind)
+	}()
+
+	sidecar := map[string]interface{}{"name": "sidecar", "image": "busybox"}
+	objects := []patch.Object{{Op: patch.OpAdd, RequestObjectType: patch.CONTAINER, TargetObjectType: "pipeline", RequestSpec: sidecar}}
+
+	result, err := patch.Render(objects, []byte(`{"apiVersion": "example.com/v1", "kind": "Pipeline", "metadata": {}, "spec": {"a": {}}}`))
+	assert.NoError(t, err, "Rendering should not produce an error")
+	assert.Equal(t, []patch.PatchOperation{
+		{Op: "add", Path: "/spec/a/spec", Value: map[string]interface{}{}},
+		{Op: "add", Path: "/spec/a/spec/containers", Value: []interface{}{sidecar}},
+	}, result.Operations[:2])
+	assert.Len(t, result.Operations, 4)
+	assert.Equal(t, []string{"pod template /spec/b is not in the object"}, result.Skipped)
+}
@@ -0,0 +1,337 @@
+package patch
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// AnyVersion matches every version of a group and kind
+const AnyVersion = "*"
+
+var (
+	ErrTemplatePathNotFound = errors.New("pod template paths not found")
+	ErrBuiltInTemplatePath  = errors.New("pod template paths of built-in kinds cannot be changed")
+	ErrAmbiguousTarget      = errors.New("target object type is a kind of several groups")
+	ErrTemplatePathStore    = errors.New("failed to persist the pod template paths")
+)
+
+// TemplatePath maps a group/version/kind to the JSON pointers of the pod templates it embeds. A pod template
+// pointer points at an object with the metadata and spec of a pod, so "/spec/template" for a Deployment and ""
+// for a bare Pod, which is its own template.
+type TemplatePath struct {
+	Group   string   `json:"group" yaml:"group"`
+	Version string   `json:"version" yaml:"version"` // AnyVersion or empty matches every version
+	Kind    string   `json:"kind" yaml:"kind"`
+	Paths   []string `json:"paths" yaml:"paths"`
+	BuiltIn bool     `json:"builtIn" yaml:"-"`
+}
+
+// builtInTemplatePaths are the pod-bearing workload kinds of Kubernetes
+var builtInTemplatePaths = []TemplatePath{
+	{Group: "", Version: "v1", Kind: "Pod", Paths: []string{""}},
+	{Group: "apps", Version: AnyVersion, Kind: "Deployment", Paths: []string{"/spec/template"}},
+	{Group: "apps", Version: AnyVersion, Kind: "StatefulSet", Paths: []string{"/spec/template"}},
+	{Group: "apps", Version: AnyVersion, Kind: "DaemonSet", Paths: []string{"/spec/template"}},
+	{Group: "apps", Version: AnyVersion, Kind: "ReplicaSet", Paths: []string{"/spec/template"}},
+	{Group: "batch", Version: AnyVersion, Kind: "Job", Paths: []string{"/spec/template"}},
+	{Group: "batch", Version: AnyVersion, Kind: "CronJob", Paths: []string{"/spec/jobTemplate/spec/template"}},
+}
+
+// DefaultResolver is the resolver consulted when patch sets are compiled and rendered
+var DefaultResolver = NewResolver()
+
+// Resolver resolves the pod template paths of the admitted object from its group, version and kind. The
+// built-in workload kinds are always registered, custom resources are added from the configuration or the
+// management API. Once the resolver persists its entries, those of the management API are kept in the store
+// of the patch sets, so the patch sets targeting them can be restored after a restart and by every replica.
+type Resolver struct {
+	mu      sync.RWMutex
+	entries map[templateKey]TemplatePath
+
+	// writeMu serializes the changes, so a change waiting for the store does not block Resolve
+	writeMu   sync.Mutex
+	store     TemplatePathStore
+	persisted map[templateKey]struct{}
+}
+
+// templateKey identifies a TemplatePath, the kind is lower-cased
+type templateKey struct {
+	group, version, kind string
+}
+
+func keyOf(group, version, kind string) templateKey {
+	if version == "" {
+		version = AnyVersion
+	}
+
+	return templateKey{group: group, version: version, kind: strings.ToLower(kind)}
+}
+
+// NewResolver creates a Resolver with the built-in workload kinds
+func NewResolver() *Resolver {
+	r := &Resolver{entries: make(map[templateKey]TemplatePath), persisted: make(map[templateKey]struct{})}
+	for _, entry := range builtInTemplatePaths {
+		entry.Version = keyOf(entry.Group, entry.Version, entry.Kind).version
+		entry.BuiltIn = true
+		r.entries[keyOf(entry.Group, entry.Version, entry.Kind)] = entry
+	}
+
+	return r
+}
+
+// Resolve returns the pod template paths of an object with the apiVersion and kind. An entry for the exact
+// version takes precedence over an entry for every version.
+func (r *Resolver) Resolve(apiVersion, kind string) ([]string, bool) {
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return nil, false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if entry, ok := r.entries[keyOf(gv.Group, gv.Version, kind)]; ok {
+		return entry.Paths, true
+	}
+	if entry, ok := r.entries[keyOf(gv.Group, AnyVersion, kind)]; ok {
+		return entry.Paths, true
+	}
+
+	return nil, false
+}
+
+// ResolveTarget returns the entry of a target object type, either a lower-cased kind such as "deployment" or a
+// lower-cased kind qualified with its group such as "rollout.argoproj.io". A bare kind registered by several
+// groups is ambiguous. The first version of the group and kind is returned.
+func (r *Resolver) ResolveTarget(targetObjectType string) (TemplatePath, error) {
+	var (
+		found TemplatePath
+		ok    bool
+	)
+	for _, entry := range r.List() {
+		if targetObjectType == targetOf(entry.Group, entry.Kind) {
+			return entry, nil
+		}
+		if targetObjectType != strings.ToLower(entry.Kind) {
+			continue
+		}
+
+		if ok && found.Group != entry.Group {
+			return TemplatePath{}, fmt.Errorf("%w: %s is a kind of %s and %s", ErrAmbiguousTarget, targetObjectType, found.Group, entry.Group)
+		}
+		if !ok {
+			found, ok = entry, true
+		}
+	}
+
+	if !ok {
+		return TemplatePath{}, fmt.Errorf("%w: %s", ErrTemplatePathNotFound, targetObjectType)
+	}
+
+	return found, nil
+}
+
+// targetOf returns the target object type of a group and kind, the lower-cased kind qualified with the group
+// unless it is the core group
+func targetOf(group, kind string) string {
+	if group == "" {
+		return strings.ToLower(kind)
+	}
+
+	return strings.ToLower(kind) + "." + group
+}
+
+// List returns every entry sorted by group, kind and version
+func (r *Resolver) List() []TemplatePath {
+	r.mu.RLock()
+	entries := make([]TemplatePath, 0, len(r.entries))
+	for _, entry := range r.entries {
+		entries = append(entries, entry)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Group != b.Group {
+			return a.Group < b.Group
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Version < b.Version
+	})
+
+	return entries
+}
+
+// Put registers or replaces the pod template paths of a custom resource, persisting them first when the resolver
+// persists its entries
+func (r *Resolver) Put(entry TemplatePath) error {
+	if err := validateTemplatePath(entry); err != nil {
+		return err
+	}
+
+	key := keyOf(entry.Group, entry.Version, entry.Kind)
+	entry.Version = key.version
+	entry.Paths = append([]string(nil), entry.Paths...)
+	entry.BuiltIn = false
+
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	r.mu.RLock()
+	current, ok := r.entries[key]
+	r.mu.RUnlock()
+	if ok && current.BuiltIn {
+		return fmt.Errorf("%w: %s", ErrBuiltInTemplatePath, current.Kind)
+	}
+
+	if r.store != nil {
+		err := r.store.UpdateTemplatePaths(func(current []TemplatePath) ([]TemplatePath, error) {
+			return append(withoutTemplatePath(current, key), entry), nil
+		})
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrTemplatePathStore, err)
+		}
+		r.persisted[key] = struct{}{}
+	}
+
+	r.mu.Lock()
+	r.entries[key] = entry
+	r.mu.Unlock()
+
+	return nil
+}
+
+// Delete removes the pod template paths of a custom resource, from the store as well when they were persisted
+func (r *Resolver) Delete(group, version, kind string) error {
+	key := keyOf(group, version, kind)
+
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	r.mu.RLock()
+	current, ok := r.entries[key]
+	r.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTemplatePathNotFound, schema.GroupVersionKind{Group: group, Version: key.version, Kind: kind})
+	}
+	if current.BuiltIn {
+		return fmt.Errorf("%w: %s", ErrBuiltInTemplatePath, current.Kind)
+	}
+
+	if _, ok = r.persisted[key]; ok {
+		err := r.store.UpdateTemplatePaths(func(current []TemplatePath) ([]TemplatePath, error) {
+			return withoutTemplatePath(current, key), nil
+		})
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrTemplatePathStore, err)
+		}
+		delete(r.persisted, key)
+	}
+
+	r.mu.Lock()
+	delete(r.entries, key)
+	r.mu.Unlock()
+
+	return nil
+}
+
+// Persist restores the entries persisted in the store and persists every later change of the management API in
+// it. It must be called before the patch sets of the store are restored, so those targeting the restored custom
+// resources compile.
+func (r *Resolver) Persist(store TemplatePathStore) error {
+	entries, err := store.LoadTemplatePaths()
+	if err != nil {
+		return fmt.Errorf("failed to load the pod template paths: %w", err)
+	}
+
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	r.store = store
+	r.sync(entries)
+
+	return nil
+}
+
+// Sync converges the entries restored from the store on the entries of a store shared with other replicas, without
+// writing back to the store. Entries of the configuration the store has no entry for are kept.
+func (r *Resolver) Sync(entries []TemplatePath) {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	r.sync(entries)
+}
+
+// sync replaces the persisted entries. The caller must hold the writer lock.
+func (r *Resolver) sync(entries []TemplatePath) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key := range r.persisted {
+		delete(r.entries, key)
+	}
+
+	r.persisted = make(map[templateKey]struct{}, len(entries))
+	for _, entry := range entries {
+		if err := validateTemplatePath(entry); err != nil {
+			log.Printf("Failed to restore the pod template paths of %s: %v", entry.Kind, err)
+			continue
+		}
+
+		key := keyOf(entry.Group, entry.Version, entry.Kind)
+		if current, ok := r.entries[key]; ok && current.BuiltIn {
+			log.Printf("Failed to restore the pod template paths of %s: %v", entry.Kind, ErrBuiltInTemplatePath)
+			continue
+		}
+
+		entry.Version = key.version
+		entry.BuiltIn = false
+		r.entries[key] = entry
+		r.persisted[key] = struct{}{}
+	}
+}
+
+// withoutTemplatePath returns the entries without the entry of the key
+func withoutTemplatePath(entries []TemplatePath, key templateKey) []TemplatePath {
+	result := make([]TemplatePath, 0, len(entries)+1)
+	for _, entry := range entries {
+		if keyOf(entry.Group, entry.Version, entry.Kind) != key {
+			result = append(result, entry)
+		}
+	}
+
+	return result
+}
+
+// validateTemplatePath checks that the entry has a kind and valid JSON pointers
+func validateTemplatePath(entry TemplatePath) error {
+	if entry.Kind == "" {
+		return fmt.Errorf("kind is required")
+	}
+
+	if entry.Version != "" && entry.Version != AnyVersion {
+		if _, err := schema.ParseGroupVersion(schema.GroupVersion{Group: entry.Group, Version: entry.Version}.String()); err != nil {
+			return fmt.Errorf("invalid group version: %w", err)
+		}
+	}
+
+	if len(entry.Paths) == 0 {
+		return fmt.Errorf("at least one pod template path is required for %s", entry.Kind)
+	}
+
+	for _, path := range entry.Paths {
+		if path != "" && (!strings.HasPrefix(path, "/") || strings.HasSuffix(path, "/")) {
+			return fmt.Errorf("pod template path %q of %s must be a JSON pointer starting with /", path, entry.Kind)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package patch_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/chungeun-choi/webhook/pkg/patch"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// TestResolver tests that custom resources become patch targets once their pod template paths are registered.
+func TestResolver(t *testing.T) {
+	rollout := patch.TemplatePath{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout", Paths: []string{"/spec/template"}}
+	objects := []patch.Object{
+		{Op: patch.OpAdd, RequestObjectType: patch.CONTAINER, TargetObjectType: "rollout", RequestSpec: map[string]interface{}{
+			"name": "sidecar", "image": "busybox",
+		}},
+	}
+	raw := []byte(`{"apiVersion": "argoproj.io/v1alpha1", "kind": "Rollout", "metadata": {}, "spec": {"template": {"spec": {}}}}`)
+
+	// The kind is unknown before it is registered
+	_, err := patch.Compile("rollout", objects)
+	assert.Error(t, err, "Compiling an unknown target object type should produce an error")
+
+	assert.NoError(t, patch.DefaultResolver.Put(rollout), "Registering the pod template paths should not produce an error")
+	defer func() {
+		_ = patch.DefaultResolver.Delete(rollout.Group, rollout.Version, rollout.Kind)
+	}()
+
+	paths, ok := patch.DefaultResolver.Resolve("argoproj.io/v1alpha1", "Rollout")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"/spec/template"}, paths)
+	_, ok = patch.DefaultResolver.Resolve("argoproj.io/v1beta1", "Rollout")
+	assert.False(t, ok, "Only the registered version should resolve")
+
+	result, err := patch.Render(objects, raw)
+	assert.NoError(t, err, "Rendering should not produce an error")
+	assert.Equal(t, "/spec/template/spec/containers", result.Operations[0].Path)
+
+	// Built-in kinds cannot be changed, invalid pointers are rejected
+	assert.Error(t, patch.DefaultResolver.Put(patch.TemplatePath{Group: "apps", Kind: "Deployment", Paths: []string{"/spec"}}))
+	assert.Error(t, patch.DefaultResolver.Delete("apps", "", "Deployment"))
+	assert.Error(t, patch.DefaultResolver.Put(patch.TemplatePath{Group: "example.com", Kind: "Thing", Paths: []string{"spec/template"}}))
+}
+
+// TestResolverGroups tests that kinds of different groups do not collide.
+func TestResolverGroups(t *testing.T) {
+	argo := patch.TemplatePath{Group: "argoproj.io", Kind: "Rollout", Paths: []string{"/spec/template"}}
+	other := patch.TemplatePath{Group: "example.com", Kind: "Rollout", Paths: []string{"/spec/pod"}}
+	objects := func(target string) []patch.Object {
+		return []patch.Object{
+			{Op: patch.OpAdd, RequestObjectType: patch.CONTAINER, TargetObjectType: target, RequestSpec: map[string]interface{}{
+				"name": "sidecar", "image": "busybox",
+			}},
+		}
+	}
+
+	for _, entry := range []patch.TemplatePath{argo, other} {
+		assert.NoError(t, patch.DefaultResolver.Put(entry))
+		defer func(entry patch.TemplatePath) {
+			_ = patch.DefaultResolver.Delete(entry.Group, entry.Version, entry.Kind)
+		}(entry)
+	}
+
+	// A bare kind of several groups is ambiguous
+	_, err := patch.DefaultResolver.ResolveTarget("rollout")
+	assert.ErrorIs(t, err, patch.ErrAmbiguousTarget)
+	_, err = patch.Compile("rollout", objects("rollout"))
+	assert.Error(t, err)
+
+	plan, err := patch.Compile("rollout", objects("rollout.example.com"))
+	assert.NoError(t, err)
+
+	// Only the object of the targeted group is patched
+	result, err := plan.Render([]byte(`{"apiVersion": "argoproj.io/v1alpha1", "kind": "Rollout", "metadata": {}, "spec": {"template": {}}}`))
+	assert.NoError(t, err)
+	assert.Empty(t, result.Operations)
+	result, err = plan.Render([]byte(`{"apiVersion": "example.com/v1", "kind": "Rollout", "metadata": {}, "spec": {"pod": {}}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "/spec/pod/spec/containers", result.Operations[1].Path)
+}
+
+// TestResolverPersist tests that the pod template paths of the management API are restored from the store of the
+// patch sets and removed from it.
+func TestResolverPersist(t *testing.T) {
+	fileStore, err := patch.NewFileStore(filepath.Join(t.TempDir(), "patches.json"))
+	assert.NoError(t, err)
+	stores := map[string]interface {
+		patch.Store
+		patch.TemplatePathStore
+	}{
+		"file":      fileStore,
+		"configmap": newConfigMapStore(fake.NewSimpleClientset(), 0),
+	}
+	rollout := patch.TemplatePath{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout", Paths: []string{"/spec/template"}}
+
+	for name, store := range stores {
+		first := patch.NewResolver()
+		assert.NoError(t, first.Persist(store), name)
+		assert.NoError(t, first.Put(rollout), name)
+
+		// A restarted server or another replica restores the entry
+		second := patch.NewResolver()
+		assert.NoError(t, second.Persist(store), name)
+		_, ok := second.Resolve("argoproj.io/v1alpha1", "Rollout")
+		assert.True(t, ok, name)
+
+		// The pod template paths are not mistaken for a patch set
+		patchSets, err := store.Load()
+		assert.NoError(t, err, name)
+		assert.Empty(t, patchSets, name)
+
+		assert.NoError(t, first.Delete(rollout.Group, rollout.Version, rollout.Kind), name)
+		entries, err := store.LoadTemplatePaths()
+		assert.NoError(t, err, name)
+		assert.Empty(t, entries, name)
+
+		second.Sync(entries)
+		_, ok = second.Resolve("argoproj.io/v1alpha1", "Rollout")
+		assert.False(t, ok, name)
+	}
+}
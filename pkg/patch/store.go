@@ -0,0 +1,35 @@
+package patch
+
+import "context"
+
+// Store persists the patch sets of a Registry, so they survive a restart of the server. The Registry calls the
+// store before a change is applied, and a change the store fails to persist is not applied.
+type Store interface {
+	// Load returns every persisted patch set
+	Load() ([]PatchBase, error)
+	// Update persists the patch set update returns from the persisted patch set of the endpoint, nil when the
+	// endpoint has none. A store shared with other writers runs update again on the latest patch set when another
+	// writer changed it in between, so no concurrent change is lost. An error of update is returned as is and
+	// nothing is written.
+	Update(endpoint string, update func(current []Object) ([]Object, error)) error
+	// Delete removes the patch set of the endpoint, an unknown endpoint is not an error
+	Delete(endpoint string) error
+}
+
+// TemplatePathStore is a store which also persists the pod template paths registered through the management API,
+// so the patch sets targeting those custom resources can be restored
+type TemplatePathStore interface {
+	// LoadTemplatePaths returns every persisted pod template path
+	LoadTemplatePaths() ([]TemplatePath, error)
+	// UpdateTemplatePaths persists the pod template paths update returns from the persisted ones. Like Update, a
+	// store shared with other writers runs update again on the latest pod template paths on a conflict.
+	UpdateTemplatePaths(update func(current []TemplatePath) ([]TemplatePath, error)) error
+}
+
+// WatchableStore is a Store shared by several replicas of the server, which reports the patch sets whenever
+// another replica changes them
+type WatchableStore interface {
+	Store
+	// Watch calls onChange with every persisted patch set whenever they change, until the context is done
+	Watch(ctx context.Context, onChange func(patchSets []PatchBase)) error
+}
@@ -22,9 +22,16 @@ type RequestPatch PatchBase
 
 type ResponsePatch struct {
 	EndpointPath    string           `json:"endpointPath"`
+	Objects         []Object         `json:"objects"`
 	PatchOperations []PatchOperation `json:"patchOperations"`
 }
 
+// RenderResult is the outcome of rendering the objects against an admitted object
+type RenderResult struct {
+	Operations []PatchOperation // operations to send to the API server, empty when nothing changed
+	Skipped    []string         // reasons why objects were not injected
+}
+
 type ResponseBody struct {
 	Message string `json:"message"`
 }
@@ -33,16 +40,55 @@ type ResponsePatchList struct {
 	PatchList []ResponsePatch `json:"patchList"`
 }
 
+type ResponsePreview struct {
+	EndpointPath string `json:"endpointPath"`
+	Revision     string `json:"revision"`
+	Preview
+}
+
+// FieldError is a single error of the typed validation of a patch set
+type FieldError struct {
+	Field  string `json:"field"`
+	Type   string `json:"type"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type ResponseValidationError struct {
+	Message string       `json:"message"`
+	Errors  []FieldError `json:"errors"`
+}
+
+type ResponseTemplatePathList struct {
+	TemplatePaths []TemplatePath `json:"templatePaths"`
+}
+
 // Constant for the target request	object type
 const (
 	CONTAINER = "container"
-	POD       = "test_patch"
+	POD       = "pod"
 	VOLUME    = "volume"
 )
 
-// Constant for the target object type
+// Constant for the target object type, the lower-cased kind of the admitted object
 const (
+	BAREPOD     = "pod"
 	DEPLOYMENT  = "deployment"
 	STATEFULSET = "statefulset"
+	DAEMONSET   = "daemonset"
+	REPLICASET  = "replicaset"
+	JOB         = "job"
+	CRONJOB     = "cronjob"
+)
+
+// Constant for the JSON patch operation
+const (
+	OpAdd     = "add"
+	OpReplace = "replace"
+)
+
+// Constant for the injection marker annotations
+const (
+	admissionWebhookAnnotationStatusKey   = "sidecar-injector-webhook.morven.me/status"
+	admissionWebhookAnnotationRevisionKey = "sidecar-injector-webhook.morven.me/revision"
+	admissionWebhookStatusInjected        = "injected"
 )
-const admissionWebhookAnnotationStatusKey = "sidecar-injector-webhook.morven.me/status"
@@ -0,0 +1,275 @@
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	kjson "sigs.k8s.io/json"
+)
+
+// ValidationError is returned when a patch set does not pass the typed validation
+type ValidationError struct {
+	Errors field.ErrorList
+}
+
+func (e *ValidationError) Error() string {
+	return e.Errors.ToAggregate().Error()
+}
+
+// FieldErrors returns the errors in the form returned by the management API
+func (e *ValidationError) FieldErrors() []FieldError {
+	errs := make([]FieldError, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		errs = append(errs, FieldError{
+			Field:  err.Field,
+			Type:   string(err.Type),
+			Detail: err.Detail,
+		})
+	}
+
+	return errs
+}
+
+// Validate decodes the spec of every object into its corev1 type with strict field checking and reports unknown
+// fields, malformed values and missing required fields with their JSON paths
+func Validate(objects []Object) error {
+	var errs field.ErrorList
+	for i, obj := range objects {
+		errs = append(errs, validateObject(obj, field.NewPath("objects").Index(i))...)
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+
+	return nil
+}
+
+// validateObject validates a single object of the patch set
+func validateObject(obj Object, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if obj.Op != "" && obj.Op != OpAdd && obj.Op != OpReplace {
+		errs = append(errs, field.NotSupported(path.Child("op"), obj.Op, []string{OpAdd, OpReplace}))
+	}
+
+	if _, err := DefaultResolver.ResolveTarget(obj.TargetObjectType); errors.Is(err, ErrAmbiguousTarget) {
+		errs = append(errs, field.Invalid(path.Child("targetObjectType"), obj.TargetObjectType, "kind of several groups, qualify it with the group such as rollout.argoproj.io"))
+	} else if err != nil {
+		errs = append(errs, field.Invalid(path.Child("targetObjectType"), obj.TargetObjectType, "unsupported target object type"))
+	}
+
+	specPath := path.Child("spec")
+	if obj.RequestSpec == nil {
+		return append(errs, field.Required(specPath, ""))
+	}
+
+	switch obj.RequestObjectType {
+	case CONTAINER:
+		var container corev1.Container
+		if decodeErrs := decodeStrict(obj.RequestSpec, &container, specPath); len(decodeErrs) > 0 {
+			return append(errs, decodeErrs...)
+		}
+		errs = append(errs, validateContainer(&container, specPath)...)
+	case VOLUME:
+		var volume corev1.Volume
+		if decodeErrs := decodeStrict(obj.RequestSpec, &volume, specPath); len(decodeErrs) > 0 {
+			return append(errs, decodeErrs...)
+		}
+		errs = append(errs, validateVolume(&volume, specPath)...)
+	case POD:
+		var podSpec corev1.PodSpec
+		if decodeErrs := decodeStrict(obj.RequestSpec, &podSpec, specPath); len(decodeErrs) > 0 {
+			return append(errs, decodeErrs...)
+		}
+		errs = append(errs, validatePodSpec(&podSpec, specPath)...)
+	default:
+		errs = append(errs, field.NotSupported(path.Child("requestObjectType"), obj.RequestObjectType, []string{CONTAINER, VOLUME, POD}))
+	}
+
+	return errs
+}
+
+// decodeStrict decodes the spec into the typed value and reports unknown, duplicated and malformed fields
+func decodeStrict(spec interface{}, out interface{}, path *field.Path) field.ErrorList {
+	if _, ok := spec.(map[string]interface{}); !ok {
+		return field.ErrorList{field.TypeInvalid(path, spec, "must be an object")}
+	}
+
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return field.ErrorList{field.Invalid(path, spec, err.Error())}
+	}
+
+	strictErrs, err := kjson.UnmarshalStrict(data, out)
+	if err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			// The field of the error has no array indexes, they are recovered from the offset of the value
+			fieldPath := typeErr.Field
+			if indexed, ok := fieldPathAt(data, typeErr.Offset); ok {
+				fieldPath = indexed
+			}
+			return field.ErrorList{field.TypeInvalid(childPath(path, fieldPath), typeErr.Value, "must be of type "+typeErr.Type.String())}
+		}
+		return field.ErrorList{field.Invalid(path, nil, err.Error())}
+	}
+
+	var errs field.ErrorList
+	for _, strictErr := range strictErrs {
+		var fieldErr kjson.FieldError
+		if errors.As(strictErr, &fieldErr) {
+			// the message is "unknown field" or "duplicate field" followed by the quoted path
+			detail := strings.TrimSuffix(strictErr.Error(), fmt.Sprintf(" %q", fieldErr.FieldPath()))
+			errs = append(errs, field.Forbidden(childPath(path, fieldErr.FieldPath()), detail))
+			continue
+		}
+		errs = append(errs, field.Invalid(path, nil, strictErr.Error()))
+	}
+
+	return errs
+}
+
+// fieldPathAt returns the dotted path, such as "ports[0].containerPort", of the value of the JSON document that
+// ends at the offset, or whose opening delimiter does
+func fieldPathAt(data []byte, offset int64) (string, bool) {
+	type frame struct {
+		array     bool
+		index     int
+		key       string
+		expectKey bool
+	}
+
+	var stack []*frame
+	// next moves the innermost container past the value just read
+	next := func() {
+		if len(stack) == 0 {
+			return
+		}
+		if top := stack[len(stack)-1]; top.array {
+			top.index++
+		} else {
+			top.expectKey = true
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	for {
+		start := dec.InputOffset()
+		token, err := dec.Token()
+		if err != nil {
+			return "", false
+		}
+
+		delim, isDelim := token.(json.Delim)
+		if isDelim && (delim == '}' || delim == ']') {
+			stack = stack[:len(stack)-1]
+			next()
+			continue
+		}
+		if n := len(stack); n > 0 && stack[n-1].expectKey {
+			stack[n-1].key, stack[n-1].expectKey = token.(string), false
+			continue
+		}
+
+		if start < offset && offset <= dec.InputOffset() {
+			var b strings.Builder
+			for _, f := range stack {
+				if f.array {
+					fmt.Fprintf(&b, "[%d]", f.index)
+				} else {
+					b.WriteString("." + f.key)
+				}
+			}
+			return strings.TrimPrefix(b.String(), "."), b.Len() > 0
+		}
+
+		if isDelim {
+			stack = append(stack, &frame{array: delim == '[', expectKey: delim == '{'})
+		} else {
+			next()
+		}
+	}
+}
+
+// childPath appends a dotted field path such as "ports[0].containerPort" to the path
+func childPath(path *field.Path, fieldPath string) *field.Path {
+	return field.NewPath(path.String() + "." + fieldPath)
+}
+
+// validateContainer checks the required fields of a container
+func validateContainer(container *corev1.Container, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if container.Name == "" {
+		errs = append(errs, field.Required(path.Child("name"), ""))
+	} else {
+		for _, msg := range validation.IsDNS1123Label(container.Name) {
+			errs = append(errs, field.Invalid(path.Child("name"), container.Name, msg))
+		}
+	}
+
+	if container.Image == "" {
+		errs = append(errs, field.Required(path.Child("image"), ""))
+	}
+
+	return errs
+}
+
+// validateVolume checks the required fields of a volume and that it has exactly one volume source
+func validateVolume(volume *corev1.Volume, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if volume.Name == "" {
+		errs = append(errs, field.Required(path.Child("name"), ""))
+	} else {
+		for _, msg := range validation.IsDNS1123Label(volume.Name) {
+			errs = append(errs, field.Invalid(path.Child("name"), volume.Name, msg))
+		}
+	}
+
+	// Every volume source is a pointer field of VolumeSource
+	sources := 0
+	value := reflect.ValueOf(volume.VolumeSource)
+	for i := 0; i < value.NumField(); i++ {
+		if !value.Field(i).IsNil() {
+			sources++
+		}
+	}
+
+	switch {
+	case sources == 0:
+		errs = append(errs, field.Required(path, "must specify a volume type"))
+	case sources > 1:
+		errs = append(errs, field.Forbidden(path, "may not specify more than 1 volume type"))
+	}
+
+	return errs
+}
+
+// validatePodSpec checks the containers and volumes of a pod spec
+func validatePodSpec(podSpec *corev1.PodSpec, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	for i := range podSpec.InitContainers {
+		errs = append(errs, validateContainer(&podSpec.InitContainers[i], path.Child("initContainers").Index(i))...)
+	}
+
+	for i := range podSpec.Containers {
+		errs = append(errs, validateContainer(&podSpec.Containers[i], path.Child("containers").Index(i))...)
+	}
+
+	for i := range podSpec.Volumes {
+		errs = append(errs, validateVolume(&podSpec.Volumes[i], path.Child("volumes").Index(i))...)
+	}
+
+	return errs
+}
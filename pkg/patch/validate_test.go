@@ -0,0 +1,43 @@
+package patch_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/chungeun-choi/webhook/pkg/patch"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestValidate tests that unknown fields, malformed values and missing required fields are reported with their paths.
+func TestValidate(t *testing.T) {
+	err := patch.Validate([]patch.Object{
+		{Op: patch.OpAdd, RequestObjectType: patch.CONTAINER, TargetObjectType: patch.DEPLOYMENT, RequestSpec: map[string]interface{}{
+			"name": "sidecar", "imagee": "busybox",
+		}},
+		{Op: patch.OpAdd, RequestObjectType: patch.CONTAINER, TargetObjectType: patch.DEPLOYMENT, RequestSpec: map[string]interface{}{
+			"name": "sidecar", "image": "busybox", "ports": []interface{}{
+				map[string]interface{}{"containerPort": 80}, map[string]interface{}{"containerPort": "8080"},
+			},
+		}},
+		{Op: patch.OpAdd, RequestObjectType: patch.VOLUME, TargetObjectType: patch.DEPLOYMENT, RequestSpec: map[string]interface{}{
+			"name": "data",
+		}},
+		{Op: patch.OpAdd, RequestObjectType: patch.POD, TargetObjectType: "unknown", RequestSpec: map[string]interface{}{
+			"containers": []interface{}{map[string]interface{}{"name": "Sidecar"}},
+		}},
+	})
+
+	var validationErr *patch.ValidationError
+	assert.True(t, errors.As(err, &validationErr), "Validating should produce a ValidationError")
+	assert.Equal(t, []patch.FieldError{
+		{Field: "objects[0].spec.imagee", Type: "FieldValueForbidden", Detail: "unknown field"},
+		{Field: "objects[1].spec.ports[1].containerPort", Type: "FieldValueTypeInvalid", Detail: "must be of type int32"},
+		{Field: "objects[2].spec", Type: "FieldValueRequired", Detail: "must specify a volume type"},
+		{Field: "objects[3].targetObjectType", Type: "FieldValueInvalid", Detail: "unsupported target object type"},
+		{Field: "objects[3].spec.containers[0].name", Type: "FieldValueInvalid", Detail: validationErr.Errors[4].Detail},
+		{Field: "objects[3].spec.containers[0].image", Type: "FieldValueRequired"},
+	}, validationErr.FieldErrors())
+
+	// A valid patch set passes
+	assert.NoError(t, patch.Validate(testObjects("sidecar")))
+}
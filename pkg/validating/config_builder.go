@@ -0,0 +1,33 @@
+package validating
+
+import (
+	"github.com/chungeun-choi/webhook/pkg/webhookconfig"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+)
+
+type ConfigBuilder struct {
+	admissionregistrationv1.ValidatingWebhookConfiguration
+}
+
+func NewValidatingConfigBuilder() *ConfigBuilder {
+	return &ConfigBuilder{}
+}
+
+func (b *ConfigBuilder) WithMetaInfo(name string) *ConfigBuilder {
+	b.ObjectMeta.Name = name
+	return b
+}
+
+// WithManagedBy labels the configuration as managed by the server, so it can be found again to update its CA bundle
+func (b *ConfigBuilder) WithManagedBy(managedBy string) *ConfigBuilder {
+	webhookconfig.WithManagedBy(&b.ObjectMeta, managedBy)
+	return b
+}
+
+func (b *ConfigBuilder) WithWebhook(builder *WebhookConfigBuilder) *ConfigBuilder {
+	b.Webhooks = append(b.Webhooks, builder.ValidatingWebhook)
+	return b
+}
+
+// WebhookConfigBuilder builds a validating webhook, whose fields are all shared with mutating webhooks
+type WebhookConfigBuilder = webhookconfig.WebhookBuilder
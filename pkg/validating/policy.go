@@ -0,0 +1,180 @@
+package validating
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Policy decides whether an admitted object is allowed. A policy returns no violations to allow the object.
+type Policy interface {
+	Validate(req *admissionv1.AdmissionRequest) ([]Violation, error)
+}
+
+// PolicyFunc adapts a function to the Policy interface
+type PolicyFunc func(req *admissionv1.AdmissionRequest) ([]Violation, error)
+
+func (f PolicyFunc) Validate(req *admissionv1.AdmissionRequest) ([]Violation, error) {
+	return f(req)
+}
+
+// PolicyRegistry holds the policy of every validation endpoint
+type PolicyRegistry struct {
+	mu       sync.RWMutex
+	policies map[string]Policy
+}
+
+// NewPolicyRegistry creates an empty PolicyRegistry
+func NewPolicyRegistry() *PolicyRegistry {
+	return &PolicyRegistry{policies: make(map[string]Policy)}
+}
+
+// Get returns the policy of the endpoint
+func (r *PolicyRegistry) Get(endpoint string) (Policy, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	policy, ok := r.policies[endpoint]
+	return policy, ok
+}
+
+// List returns the endpoints with a policy in sorted order
+func (r *PolicyRegistry) List() []string {
+	r.mu.RLock()
+	endpoints := make([]string, 0, len(r.policies))
+	for endpoint := range r.policies {
+		endpoints = append(endpoints, endpoint)
+	}
+	r.mu.RUnlock()
+
+	sort.Strings(endpoints)
+	return endpoints
+}
+
+// Put registers or replaces the policy of the endpoint
+func (r *PolicyRegistry) Put(endpoint string, policy Policy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.policies[endpoint] = policy
+}
+
+// AddRules appends the rules to the rule set of the endpoint, creating the endpoint if it does not exist. An
+// endpoint whose policy is not a RuleSet is replaced.
+func (r *PolicyRegistry) AddRules(endpoint string, rules []PolicyRule) (*RuleSet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if current, ok := r.policies[endpoint].(*RuleSet); ok {
+		rules = append(append(make([]PolicyRule, 0, len(current.rules)+len(rules)), current.rules...), rules...)
+	}
+
+	rs, err := NewRuleSet(rules)
+	if err != nil {
+		return nil, err
+	}
+	r.policies[endpoint] = rs
+
+	return rs, nil
+}
+
+// ReplaceRules replaces the policy of an existing endpoint with a rule set and reports whether the endpoint
+// existed. The endpoint is checked and replaced under one lock, so a concurrent Delete is not undone.
+func (r *PolicyRegistry) ReplaceRules(endpoint string, rules []PolicyRule) (*RuleSet, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.policies[endpoint]; !ok {
+		return nil, false, nil
+	}
+
+	rs, err := NewRuleSet(rules)
+	if err != nil {
+		return nil, true, err
+	}
+	r.policies[endpoint] = rs
+
+	return rs, true, nil
+}
+
+// Delete removes the policy of the endpoint and reports whether it existed
+func (r *PolicyRegistry) Delete(endpoint string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.policies[endpoint]; !ok {
+		return false
+	}
+	delete(r.policies, endpoint)
+
+	return true
+}
+
+// Review builds the admission response for the request with the policy registered for the endpoint. The object is
+// denied when the policy reports violations, and every violation is returned as a cause of the status.
+func (r *PolicyRegistry) Review(endpoint string, req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	var result *admissionv1.AdmissionResponse = new(admissionv1.AdmissionResponse)
+
+	policy, ok := r.Get(endpoint)
+	if !ok {
+		result.Result = &metav1.Status{
+			Message: "No policy found",
+		}
+		return result
+	}
+
+	violations, err := policy.Validate(req)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		result.Result = &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Code:    http.StatusInternalServerError,
+			Reason:  metav1.StatusReasonInternalError,
+			Message: fmt.Sprintf("failed to evaluate policy %s: %v", endpoint, err),
+		}
+		return result
+	}
+
+	if len(violations) == 0 {
+		result.Allowed = true
+		return result
+	}
+
+	return denied(endpoint, violations)
+}
+
+// denied builds the admission response denying the object for the violations
+func denied(endpoint string, violations []Violation) *admissionv1.AdmissionResponse {
+	messages := make([]string, 0, len(violations))
+	causes := make([]metav1.StatusCause, 0, len(violations))
+	for _, violation := range violations {
+		message := violation.Message
+		if violation.Field != "" {
+			message = fmt.Sprintf("%s: %s", violation.Field, violation.Message)
+		}
+		messages = append(messages, message)
+
+		causes = append(causes, metav1.StatusCause{
+			Type:    metav1.CauseTypeFieldValueInvalid,
+			Message: violation.Message,
+			Field:   violation.Field,
+		})
+	}
+
+	return &admissionv1.AdmissionResponse{
+		Allowed: false,
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Code:    http.StatusForbidden,
+			Reason:  metav1.StatusReasonForbidden,
+			Message: fmt.Sprintf("denied by policy %s: %s", endpoint, strings.Join(messages, "; ")),
+			Details: &metav1.StatusDetails{Causes: causes},
+		},
+	}
+}
@@ -0,0 +1,46 @@
+package validating_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/chungeun-choi/webhook/pkg/validating"
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+func TestPolicyRegistryReview(t *testing.T) {
+	registry := validating.NewPolicyRegistry()
+	registry.Put("labels", validating.PolicyFunc(func(req *admissionv1.AdmissionRequest) ([]validating.Violation, error) {
+		if req.Namespace == "default" {
+			return []validating.Violation{{Field: "metadata.namespace", Message: "must not be default"}}, nil
+		}
+		return nil, nil
+	}))
+
+	allowed := registry.Review("labels", &admissionv1.AdmissionRequest{Namespace: "apps"})
+	assert.True(t, allowed.Allowed)
+
+	denied := registry.Review("labels", &admissionv1.AdmissionRequest{Namespace: "default"})
+	assert.False(t, denied.Allowed)
+	assert.Equal(t, int32(http.StatusForbidden), denied.Result.Code)
+	assert.Contains(t, denied.Result.Message, "metadata.namespace: must not be default")
+	assert.Len(t, denied.Result.Details.Causes, 1)
+	assert.Equal(t, "metadata.namespace", denied.Result.Details.Causes[0].Field)
+
+	missing := registry.Review("unknown", &admissionv1.AdmissionRequest{})
+	assert.False(t, missing.Allowed)
+
+	// Only the policy of an existing endpoint is replaced
+	_, ok, err := registry.ReplaceRules("unknown", nil)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	rs, ok, err := registry.ReplaceRules("labels", []validating.PolicyRule{{Name: "team", Path: ".metadata.labels.team", Operator: validating.OperatorExists}})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Len(t, rs.Rules(), 1)
+
+	assert.Equal(t, []string{"labels"}, registry.List())
+	assert.True(t, registry.Delete("labels"))
+	assert.False(t, registry.Delete("labels"))
+}
@@ -0,0 +1,357 @@
+package validating
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// Operators of a PolicyRule condition
+const (
+	OperatorExists    = "exists"
+	OperatorNotExists = "notExists"
+	OperatorEquals    = "equals"
+	OperatorNotEquals = "notEquals"
+	OperatorMatches   = "matches"
+	OperatorIn        = "in"
+	OperatorNotIn     = "notIn"
+)
+
+// Actions of a PolicyRule
+const (
+	// ActionRequire reports a violation when the condition does not hold
+	ActionRequire = "require"
+	// ActionDeny reports a violation when the condition holds
+	ActionDeny = "deny"
+)
+
+// PolicyRule is a declarative condition evaluated against the admitted object. Paths are JSONPath expressions
+// such as "{.metadata.labels.team}" or ".spec.hostNetwork".
+//
+// When ForEach is set, it selects a list of elements, for example "{.spec.containers[*]}", and the condition is
+// evaluated with Path relative to every element, so a violation names the offending element.
+type PolicyRule struct {
+	Name     string   `json:"name"`
+	ForEach  string   `json:"forEach,omitempty"`
+	Path     string   `json:"path"`
+	Operator string   `json:"operator"`
+	Values   []string `json:"values,omitempty"`
+	Action   string   `json:"action,omitempty"` // ActionRequire when empty
+	Message  string   `json:"message,omitempty"`
+}
+
+// RuleSet is the Policy built from a list of PolicyRule
+type RuleSet struct {
+	rules    []PolicyRule
+	compiled []compiledRule
+}
+
+// compiledRule is a validated PolicyRule with its normalized paths
+type compiledRule struct {
+	PolicyRule
+	forEach string
+	path    string
+	pattern *regexp.Regexp
+}
+
+// NewRuleSet validates the rules and builds the RuleSet evaluating them
+func NewRuleSet(rules []PolicyRule) (*RuleSet, error) {
+	rs := &RuleSet{
+		rules:    append([]PolicyRule(nil), rules...),
+		compiled: make([]compiledRule, 0, len(rules)),
+	}
+
+	for i, rule := range rs.rules {
+		compiled, err := compileRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule %d (%s): %w", i, rule.Name, err)
+		}
+		rs.compiled = append(rs.compiled, compiled)
+	}
+
+	return rs, nil
+}
+
+// Rules returns the rules of the set. The returned slice must not be modified.
+func (rs *RuleSet) Rules() []PolicyRule {
+	return rs.rules
+}
+
+// Validate evaluates every rule against the admitted object, or the old object of a DELETE
+func (rs *RuleSet) Validate(req *admissionv1.AdmissionRequest) ([]Violation, error) {
+	raw := req.Object.Raw
+	if req.Operation == admissionv1.Delete {
+		raw = req.OldObject.Raw
+	}
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	var obj interface{}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, fmt.Errorf("failed to decode the admitted object: %w", err)
+	}
+
+	var violations []Violation
+	for i := range rs.compiled {
+		found, err := rs.compiled[i].evaluate(obj)
+		if err != nil {
+			return nil, err
+		}
+		violations = append(violations, found...)
+	}
+
+	return violations, nil
+}
+
+// compileRule validates the rule and normalizes its paths
+func compileRule(rule PolicyRule) (compiledRule, error) {
+	c := compiledRule{PolicyRule: rule}
+
+	if rule.Path == "" {
+		return c, fmt.Errorf("path is required")
+	}
+	c.path = normalizePath(rule.Path)
+	if err := jsonpath.New(rule.Name).Parse(c.path); err != nil {
+		return c, fmt.Errorf("invalid path %q: %w", rule.Path, err)
+	}
+
+	if rule.ForEach != "" {
+		c.forEach = normalizePath(rule.ForEach)
+		if err := jsonpath.New(rule.Name).Parse(c.forEach); err != nil {
+			return c, fmt.Errorf("invalid forEach %q: %w", rule.ForEach, err)
+		}
+		// The elements are numbered in a single sequence, which only names them correctly for one wildcard
+		if strings.Count(c.forEach, "[*]") > 1 {
+			return c, fmt.Errorf("invalid forEach %q: only one wildcard is supported", rule.ForEach)
+		}
+	}
+
+	switch rule.Action {
+	case "":
+		c.Action = ActionRequire
+	case ActionRequire, ActionDeny:
+	default:
+		return c, fmt.Errorf("unsupported action %q", rule.Action)
+	}
+
+	switch rule.Operator {
+	case OperatorExists, OperatorNotExists:
+		if len(rule.Values) > 0 {
+			return c, fmt.Errorf("operator %s takes no values", rule.Operator)
+		}
+	case OperatorEquals, OperatorNotEquals:
+		if len(rule.Values) != 1 {
+			return c, fmt.Errorf("operator %s takes exactly one value", rule.Operator)
+		}
+	case OperatorMatches:
+		if len(rule.Values) != 1 {
+			return c, fmt.Errorf("operator %s takes exactly one value", rule.Operator)
+		}
+		pattern, err := regexp.Compile(rule.Values[0])
+		if err != nil {
+			return c, fmt.Errorf("invalid pattern %q: %w", rule.Values[0], err)
+		}
+		c.pattern = pattern
+	case OperatorIn, OperatorNotIn:
+		if len(rule.Values) == 0 {
+			return c, fmt.Errorf("operator %s takes at least one value", rule.Operator)
+		}
+	default:
+		return c, fmt.Errorf("unsupported operator %q", rule.Operator)
+	}
+
+	return c, nil
+}
+
+// evaluate returns the violations of the rule for the object
+func (c *compiledRule) evaluate(obj interface{}) ([]Violation, error) {
+	if c.forEach == "" {
+		return c.evaluateAt(obj, fieldOf(c.path))
+	}
+
+	elements, err := find(c.forEach, obj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate forEach of rule %s: %w", c.Name, err)
+	}
+
+	var violations []Violation
+	for i, element := range elements {
+		found, err := c.evaluateAt(element, elementField(c.forEach, i)+"."+fieldOf(c.path))
+		if err != nil {
+			return nil, err
+		}
+		violations = append(violations, found...)
+	}
+
+	return violations, nil
+}
+
+// evaluateAt evaluates the condition against the value and reports a violation of the field if the action demands it
+func (c *compiledRule) evaluateAt(value interface{}, field string) ([]Violation, error) {
+	values, err := find(c.path, value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate path of rule %s: %w", c.Name, err)
+	}
+
+	holds := c.holds(values)
+	if (c.Action == ActionRequire && holds) || (c.Action == ActionDeny && !holds) {
+		return nil, nil
+	}
+
+	message := c.Message
+	if message == "" {
+		message = c.describe()
+	}
+
+	return []Violation{{Field: field, Message: message}}, nil
+}
+
+// holds reports whether the condition holds for the values found at the path. Value operators need at least one
+// value and hold when every value satisfies them, the negated operators hold when no value matches.
+func (c *compiledRule) holds(values []interface{}) bool {
+	switch c.Operator {
+	case OperatorExists:
+		return len(values) > 0
+	case OperatorNotExists:
+		return len(values) == 0
+	case OperatorNotEquals, OperatorNotIn:
+		for _, value := range values {
+			if contains(c.Values, stringOf(value)) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if len(values) == 0 {
+		return false
+	}
+	for _, value := range values {
+		s := stringOf(value)
+		switch c.Operator {
+		case OperatorEquals, OperatorIn:
+			if !contains(c.Values, s) {
+				return false
+			}
+		case OperatorMatches:
+			if !c.pattern.MatchString(s) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// describe returns the default violation message of the rule
+func (c *compiledRule) describe() string {
+	var condition string
+	switch c.Operator {
+	case OperatorExists:
+		condition = "be set"
+	case OperatorNotExists:
+		condition = "not be set"
+	case OperatorEquals:
+		condition = fmt.Sprintf("equal %q", c.Values[0])
+	case OperatorNotEquals:
+		condition = fmt.Sprintf("not equal %q", c.Values[0])
+	case OperatorMatches:
+		condition = fmt.Sprintf("match %q", c.Values[0])
+	case OperatorIn:
+		condition = fmt.Sprintf("be one of %q", c.Values)
+	case OperatorNotIn:
+		condition = fmt.Sprintf("not be one of %q", c.Values)
+	}
+
+	if c.Action == ActionDeny {
+		return fmt.Sprintf("violates rule %s: must not %s", c.Name, condition)
+	}
+
+	return fmt.Sprintf("violates rule %s: must %s", c.Name, condition)
+}
+
+// find returns the non-null values found at the JSONPath. Missing keys yield no values rather than an error.
+func find(path string, obj interface{}) ([]interface{}, error) {
+	// A JSONPath keeps state while it is executed, so each evaluation parses its own
+	j := jsonpath.New("").AllowMissingKeys(true)
+	if err := j.Parse(path); err != nil {
+		return nil, err
+	}
+
+	results, err := j.FindResults(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []interface{}
+	for _, result := range results {
+		for _, value := range result {
+			if !value.IsValid() {
+				continue
+			}
+			if v := value.Interface(); v != nil {
+				values = append(values, v)
+			}
+		}
+	}
+
+	return values, nil
+}
+
+// normalizePath turns a relaxed path such as ".spec.hostNetwork" into the template "{.spec.hostNetwork}"
+func normalizePath(path string) string {
+	if strings.HasPrefix(path, "{") && strings.HasSuffix(path, "}") {
+		return path
+	}
+	if !strings.HasPrefix(path, ".") && !strings.HasPrefix(path, "[") {
+		path = "." + path
+	}
+
+	return "{" + path + "}"
+}
+
+// fieldOf returns the field named by a normalized path, "{.spec.hostNetwork}" is "spec.hostNetwork"
+func fieldOf(path string) string {
+	return strings.TrimPrefix(strings.TrimSuffix(strings.TrimPrefix(path, "{"), "}"), ".")
+}
+
+// elementField returns the field of the i-th element selected by a forEach path. Its only wildcard is replaced
+// with the index, so "{.spec.containers[*]}" names its elements "spec.containers[0]" and so on.
+func elementField(forEach string, i int) string {
+	field := fieldOf(forEach)
+	if strings.Contains(field, "[*]") {
+		return strings.Replace(field, "[*]", fmt.Sprintf("[%d]", i), 1)
+	}
+
+	return fmt.Sprintf("%s[%d]", field, i)
+}
+
+// stringOf formats a JSON value for comparison, strings are compared as they are and other values as JSON
+func stringOf(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+
+	return string(data)
+}
+
+// contains reports whether the values contain the value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,61 @@
+package validating_test
+
+import (
+	"testing"
+
+	"github.com/chungeun-choi/webhook/pkg/validating"
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const testPod = `{
+	"apiVersion": "v1",
+	"kind": "Pod",
+	"metadata": {"name": "nginx", "labels": {"app": "nginx"}},
+	"spec": {
+		"hostNetwork": true,
+		"containers": [
+			{"name": "nginx", "image": "nginx:1.27", "resources": {"limits": {"cpu": "1"}}},
+			{"name": "sidecar", "image": "busybox"}
+		]
+	}
+}`
+
+func TestRuleSetValidate(t *testing.T) {
+	rs, err := validating.NewRuleSet([]validating.PolicyRule{
+		{Name: "team-label", Path: "{.metadata.labels.team}", Operator: validating.OperatorExists},
+		{Name: "no-host-network", Path: ".spec.hostNetwork", Operator: validating.OperatorEquals, Values: []string{"true"}, Action: validating.ActionDeny},
+		{Name: "limits", ForEach: "{.spec.containers[*]}", Path: "{.resources.limits}", Operator: validating.OperatorExists, Message: "resources.limits must be set"},
+		{Name: "image-tag", ForEach: "{.spec.containers[*]}", Path: "{.image}", Operator: validating.OperatorMatches, Values: []string{`:[\w.-]+$`}},
+		{Name: "app", Path: "{.metadata.labels.app}", Operator: validating.OperatorIn, Values: []string{"nginx", "httpd"}},
+	})
+	assert.NoError(t, err)
+
+	violations, err := rs.Validate(&admissionv1.AdmissionRequest{
+		Operation: admissionv1.Create,
+		Object:    runtime.RawExtension{Raw: []byte(testPod)},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []validating.Violation{
+		{Field: "metadata.labels.team", Message: "violates rule team-label: must be set"},
+		{Field: "spec.hostNetwork", Message: `violates rule no-host-network: must not equal "true"`},
+		{Field: "spec.containers[1].resources.limits", Message: "resources.limits must be set"},
+		{Field: "spec.containers[1].image", Message: `violates rule image-tag: must match ":[\\w.-]+$"`},
+	}, violations)
+}
+
+func TestNewRuleSetInvalid(t *testing.T) {
+	for _, rule := range []validating.PolicyRule{
+		{Name: "no-path", Operator: validating.OperatorExists},
+		{Name: "bad-path", Path: "{.metadata[", Operator: validating.OperatorExists},
+		{Name: "bad-operator", Path: ".metadata", Operator: "contains"},
+		{Name: "bad-action", Path: ".metadata", Operator: validating.OperatorExists, Action: "warn"},
+		{Name: "no-value", Path: ".metadata.name", Operator: validating.OperatorEquals},
+		{Name: "bad-pattern", Path: ".metadata.name", Operator: validating.OperatorMatches, Values: []string{"("}},
+		{Name: "nested-forEach", ForEach: "{.spec.containers[*].ports[*]}", Path: ".containerPort", Operator: validating.OperatorExists},
+	} {
+		_, err := validating.NewRuleSet([]validating.PolicyRule{rule})
+		assert.Error(t, err, rule.Name)
+	}
+}
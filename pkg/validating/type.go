@@ -0,0 +1,67 @@
+package validating
+
+import (
+	"github.com/chungeun-choi/webhook/pkg/webhookconfig"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+)
+
+// ErrInvalidRequest is returned when the webhook configuration requested is invalid
+var ErrInvalidRequest = webhookconfig.ErrInvalidRequest
+
+type Rule = webhookconfig.Rule
+
+// ManagedByLabel marks the configurations registered by the server
+const ManagedByLabel = webhookconfig.ManagedByLabel
+
+// DefaultManagedBy is the value of the ManagedByLabel when the config has none
+const DefaultManagedBy = webhookconfig.DefaultManagedBy
+
+// WebhookOptions are the rules, selectors and admission settings of a single webhook
+type WebhookOptions = webhookconfig.Options
+
+// Webhook is one webhook of a configuration holding several, calling a policy endpoint
+type Webhook = webhookconfig.Webhook[WebhookOptions]
+
+// RequestAddRulesBody registers a configuration whose webhooks call policy endpoints
+type RequestAddRulesBody = webhookconfig.Request[WebhookOptions]
+
+type ResponseBody struct {
+	Message string `json:"message"`
+}
+
+type ResponseAddRulesBody struct {
+	ResponseBody
+	ConfigBuilder
+}
+
+type ResponseGetRulesBody struct {
+	Message              string                                                 `json:"message"`
+	WebhookConfiguration admissionregistrationv1.ValidatingWebhookConfiguration `json:"webhookConfiguration"`
+}
+
+type RequestPolicy struct {
+	Endpoint string       `json:"endpoint"`
+	Rules    []PolicyRule `json:"rules"`
+}
+
+type ResponsePolicy struct {
+	Endpoint string       `json:"endpoint"`
+	Rules    []PolicyRule `json:"rules"`
+}
+
+type ResponsePolicyList struct {
+	Policies []ResponsePolicy `json:"policies"`
+}
+
+// Violation is a reason why a policy denies the admitted object
+type Violation struct {
+	Field   string `json:"field,omitempty"` // path of the offending field, if any
+	Message string `json:"message"`
+}
+
+const (
+	// FailurePolicyIgnore is a constant that represents the failure policy ignore
+	FailurePolicyIgnore = admissionregistrationv1.Ignore
+	// FailurePolicyFail is a constant that represents the failure policy fail
+	FailurePolicyFail = admissionregistrationv1.Fail
+)
@@ -0,0 +1,93 @@
+package validating
+
+import (
+	"strings"
+
+	"github.com/chungeun-choi/webhook/pkg/webhookconfig"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	admissionregistration "k8s.io/client-go/kubernetes/typed/admissionregistration/v1"
+)
+
+// ValidatingConfig is a struct that contains the URL, client, admission version, and failure policy
+type ValidatingConfig = webhookconfig.Config
+
+// ValidatingManager registers the validating webhook configurations
+type ValidatingManager struct {
+	*webhookconfig.Manager[admissionregistrationv1.ValidatingWebhookConfiguration, admissionregistrationv1.ValidatingWebhookConfigurationList]
+}
+
+// kind gives the shared manager access to the validating webhook configurations
+var kind = webhookconfig.Kind[admissionregistrationv1.ValidatingWebhookConfiguration, admissionregistrationv1.ValidatingWebhookConfigurationList]{
+	Name:   "validating",
+	Prefix: "policy",
+	Client: func(v1 admissionregistration.AdmissionregistrationV1Interface) webhookconfig.Client[admissionregistrationv1.ValidatingWebhookConfiguration, admissionregistrationv1.ValidatingWebhookConfigurationList] {
+		return v1.ValidatingWebhookConfigurations()
+	},
+	Equal: equalConfig,
+	Items: func(list *admissionregistrationv1.ValidatingWebhookConfigurationList) []admissionregistrationv1.ValidatingWebhookConfiguration {
+		return list.Items
+	},
+	ObjectMeta: func(config *admissionregistrationv1.ValidatingWebhookConfiguration) *metav1.ObjectMeta {
+		return &config.ObjectMeta
+	},
+	ClientConfigs: func(config *admissionregistrationv1.ValidatingWebhookConfiguration) []*admissionregistrationv1.WebhookClientConfig {
+		clientConfigs := make([]*admissionregistrationv1.WebhookClientConfig, 0, len(config.Webhooks))
+		for i := range config.Webhooks {
+			clientConfigs = append(clientConfigs, &config.Webhooks[i].ClientConfig)
+		}
+		return clientConfigs
+	},
+}
+
+// NewValidateManager is a function that creates a new instance of ValidatingManager
+func NewValidateManager(config *ValidatingConfig) *ValidatingManager {
+	return &ValidatingManager{webhookconfig.NewManager(config, kind)}
+}
+
+// Register is a method that registers the validating webhook
+func (m *ValidatingManager) Register(req RequestAddRulesBody) (*ConfigBuilder, error) {
+	req.Name = strings.ToLower(req.Name)
+	if err := webhookconfig.ValidateRequest(req, webhookconfig.ValidateOptions); err != nil {
+		return nil, err
+	}
+
+	// NewValidatingConfigBuilder is a function that creates a new instance of ConfigBuilder
+	validatingConfig := NewValidatingConfigBuilder().WithMetaInfo(req.Name).WithManagedBy(m.ManagedBy())
+	for _, webhook := range webhookconfig.WebhooksOf(req) {
+		validatingConfig.WithWebhook(m.NewWebhook(webhook.Name, webhook.Endpoint, webhook.Options))
+	}
+
+	result, err := m.Apply(&validatingConfig.ValidatingWebhookConfiguration)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ConfigBuilder{*result}, nil
+}
+
+// Get is a method that retrieves the old configuration for the validating webhook
+func (m *ValidatingManager) Get(name string) (*ConfigBuilder, error) {
+	config, err := m.Fetch(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ConfigBuilder{*config}, nil
+}
+
+// equalConfig reports whether the configuration on the server is the desired one, ignoring the metadata and the
+// defaults the server adds
+func equalConfig(desired, current *admissionregistrationv1.ValidatingWebhookConfiguration) bool {
+	if !webhookconfig.EqualMeta(&desired.ObjectMeta, &current.ObjectMeta) || len(desired.Webhooks) != len(current.Webhooks) {
+		return false
+	}
+
+	for i := range desired.Webhooks {
+		if !webhookconfig.EqualWebhook(desired.Webhooks[i], current.Webhooks[i]) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,56 @@
+package validating_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/chungeun-choi/webhook/pkg/validating"
+	"github.com/stretchr/testify/assert"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSyncCABundle(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	manager := validating.NewValidateManager(&validating.ValidatingConfig{
+		Client:           client,
+		AdmissionVersion: []string{"v1"},
+		URL:              "https://webhook.example.com:8443",
+		FailurePolicy:    admissionregistrationv1.Ignore,
+		ManagedBy:        "policy-engine",
+	})
+
+	for _, name := range []string{"labels", "images"} {
+		_, err := manager.Register(validating.RequestAddRulesBody{Name: name})
+		assert.NoError(t, err)
+	}
+
+	// A configuration created by someone else is left alone
+	_, err := client.AdmissionregistrationV1().ValidatingWebhookConfigurations().Create(context.TODO(),
+		&admissionregistrationv1.ValidatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "foreign"},
+			Webhooks:   []admissionregistrationv1.ValidatingWebhook{{Name: "foreign.example.com"}},
+		}, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	updated, err := manager.SyncCABundle(context.TODO(), []byte("rotated-ca"))
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"labels", "images"}, updated)
+	assert.Equal(t, []byte("rotated-ca"), manager.CABundle())
+
+	stored, err := manager.Get("images")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("rotated-ca"), stored.Webhooks[0].ClientConfig.CABundle)
+	assert.Equal(t, "policy-engine", stored.Labels[validating.ManagedByLabel])
+	assert.Equal(t, "https://webhook.example.com:8443/policy/images/trigger", *stored.Webhooks[0].ClientConfig.URL)
+
+	foreign, err := client.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(context.TODO(), "foreign", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Nil(t, foreign.Webhooks[0].ClientConfig.CABundle)
+
+	// Nothing is updated when the CA bundles are current
+	updated, err = manager.SyncCABundle(context.TODO(), []byte("rotated-ca"))
+	assert.NoError(t, err)
+	assert.Empty(t, updated)
+}
@@ -0,0 +1,147 @@
+package webhookconfig
+
+import (
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// WebhookBuilder builds the fields mutating and validating webhooks have in common, which are all the fields of a
+// validating webhook. A mutating webhook is built from it by adding its reinvocation policy.
+type WebhookBuilder struct {
+	admissionregistrationv1.ValidatingWebhook
+}
+
+func NewWebhookBuilder() *WebhookBuilder {
+	return &WebhookBuilder{}
+}
+
+// WithName sets the name of the webhook
+func (b *WebhookBuilder) WithName(name string) *WebhookBuilder {
+	b.Name = name
+	return b
+}
+
+// WithAdmissionReviewVersions sets the admission review versions for the webhook - required
+func (b *WebhookBuilder) WithAdmissionReviewVersions(versions ...string) *WebhookBuilder {
+	b.AdmissionReviewVersions = versions
+	return b
+}
+
+// WithSideEffect sets the side effect for the webhook - required
+func (b *WebhookBuilder) WithSideEffect(sideEffect admissionregistrationv1.SideEffectClass) *WebhookBuilder {
+	b.SideEffects = &sideEffect
+	return b
+}
+
+// WithFailurePolicy sets how an unreachable webhook or an error response is handled
+func (b *WebhookBuilder) WithFailurePolicy(policy admissionregistrationv1.FailurePolicyType) *WebhookBuilder {
+	b.FailurePolicy = &policy
+	return b
+}
+
+// WithTimeoutSeconds sets the timeout of a call to the webhook, the API server default applies when nil
+func (b *WebhookBuilder) WithTimeoutSeconds(timeout *int32) *WebhookBuilder {
+	if timeout != nil {
+		seconds := *timeout
+		b.TimeoutSeconds = &seconds
+	}
+	return b
+}
+
+// WithMatchPolicy sets how the rules match requests to other versions of a resource
+func (b *WebhookBuilder) WithMatchPolicy(policy admissionregistrationv1.MatchPolicyType) *WebhookBuilder {
+	if policy != "" {
+		b.MatchPolicy = &policy
+	}
+	return b
+}
+
+// WithMatchConditions sets the CEL conditions a request must match to be sent to the webhook
+func (b *WebhookBuilder) WithMatchConditions(conditions ...admissionregistrationv1.MatchCondition) *WebhookBuilder {
+	b.MatchConditions = append([]admissionregistrationv1.MatchCondition(nil), conditions...)
+	return b
+}
+
+// WithClientConfig sets the client configuration for the webhook to call the path on the URL - required
+func (b *WebhookBuilder) WithClientConfig(url, path string, caByte []byte) *WebhookBuilder {
+	//Use the direct URL
+	url = url + path
+	b.ClientConfig.URL = &url
+	b.ClientConfig.CABundle = caByte
+
+	return b
+}
+
+// WithServiceClientConfig sets the client configuration for the webhook to call the path through the service
+func (b *WebhookBuilder) WithServiceClientConfig(service admissionregistrationv1.ServiceReference, path string, caByte []byte) *WebhookBuilder {
+	service.Path = &path
+	if service.Port != nil {
+		port := *service.Port
+		service.Port = &port
+	}
+
+	b.ClientConfig.Service = &service
+	b.ClientConfig.CABundle = caByte
+
+	return b
+}
+
+// WithRoles sets the rules for the webhook
+func (b *WebhookBuilder) WithRoles(rules ...Rule) *WebhookBuilder {
+	for _, rule := range rules {
+		var (
+			operations []admissionregistrationv1.OperationType
+			ruleObj    admissionregistrationv1.Rule
+		)
+
+		// Set the rule object
+		ruleObj.APIGroups = rule.APIGroups
+		ruleObj.APIVersions = rule.APIVersions
+		ruleObj.Resources = rule.Resources
+
+		// Convert the string operations to the OperationType
+		for _, op := range rule.Operations {
+			operations = append(operations, admissionregistrationv1.OperationType(op))
+		}
+
+		// Append the rule with operations
+		b.Rules = append(b.Rules, admissionregistrationv1.RuleWithOperations{
+			Operations: operations,
+			Rule:       ruleObj,
+		})
+	}
+
+	return b
+}
+
+// WithNamespaceSelector scopes the webhook to the namespaces matched by the selector. A nil selector matches
+// every namespace.
+func (b *WebhookBuilder) WithNamespaceSelector(selector *metav1.LabelSelector) *WebhookBuilder {
+	b.NamespaceSelector = selector.DeepCopy()
+	return b
+}
+
+// WithObjectSelector scopes the webhook to the objects whose labels are matched by the selector. A nil selector
+// matches every object.
+func (b *WebhookBuilder) WithObjectSelector(selector *metav1.LabelSelector) *WebhookBuilder {
+	b.ObjectSelector = selector.DeepCopy()
+	return b
+}
+
+// WithManagedBy labels the configuration as managed by the server, so it can be found again to update its CA bundle
+func WithManagedBy(meta *metav1.ObjectMeta, managedBy string) {
+	if meta.Labels == nil {
+		meta.Labels = make(map[string]string)
+	}
+	meta.Labels[ManagedByLabel] = managedBy
+}
+
+// WebhookName returns the registered name of a webhook of the configuration, the name of the single webhook of
+// the configuration when webhook is empty
+func WebhookName(configuration, webhook string) string {
+	if webhook == "" {
+		return configuration + ".admission" + ".webhook"
+	}
+
+	return webhook + "." + configuration + ".admission" + ".webhook"
+}
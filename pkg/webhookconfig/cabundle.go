@@ -0,0 +1,66 @@
+package webhookconfig
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/util/retry"
+)
+
+// ManagedByLabel marks the configurations registered by the server
+const ManagedByLabel = "app.kubernetes.io/managed-by"
+
+// DefaultManagedBy is the value of the ManagedByLabel when the config has none
+const DefaultManagedBy = "webhook"
+
+// SyncCABundle writes the CA bundle into every webhook of the configurations labelled as managed by managedBy
+// whose caBundle differs. It returns the names of the updated configurations, including those updated before an
+// error.
+func SyncCABundle[C, L any](ctx context.Context, client Client[C, L], kind Kind[C, L], managedBy string, caBundle []byte) ([]string, error) {
+	list, err := client.List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{ManagedByLabel: managedBy}).String(),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list the managed configurations")
+	}
+
+	var updated []string
+	for _, item := range kind.Items(list) {
+		name := kind.ObjectMeta(&item).Name
+		changed := false
+
+		// Apply the CA bundle to the latest revision of the configuration until the update does not conflict
+		err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			current, err := client.Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+
+			changed = false
+			for _, clientConfig := range kind.ClientConfigs(current) {
+				if !bytes.Equal(clientConfig.CABundle, caBundle) {
+					clientConfig.CABundle = caBundle
+					changed = true
+				}
+			}
+			if !changed {
+				return nil
+			}
+
+			_, err = client.Update(ctx, current, metav1.UpdateOptions{})
+			return err
+		})
+		if err != nil {
+			return updated, errors.Wrapf(err, "failed to update the CA bundle of %s", name)
+		}
+
+		if changed {
+			updated = append(updated, name)
+		}
+	}
+
+	return updated, nil
+}
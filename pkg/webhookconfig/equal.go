@@ -0,0 +1,71 @@
+package webhookconfig
+
+import (
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// defaultTimeoutSeconds and defaultServicePort are the defaults the API server sets on a webhook
+const (
+	defaultTimeoutSeconds = int32(10)
+	defaultServicePort    = int32(443)
+)
+
+// EqualMeta reports whether the current metadata, as returned by the server, carries the name and labels of the
+// desired one. The server adds its own metadata, which the desired one never has.
+func EqualMeta(desired, current *metav1.ObjectMeta) bool {
+	if desired.Name != current.Name {
+		return false
+	}
+
+	for key, value := range desired.Labels {
+		if current.Labels[key] != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// EqualWebhook reports whether the current webhook, as returned by the server, is the desired one once the
+// defaults of the server are applied to both
+func EqualWebhook(desired, current admissionregistrationv1.ValidatingWebhook) bool {
+	return equality.Semantic.DeepEqual(withDefaults(desired), withDefaults(current))
+}
+
+// withDefaults returns a copy of the webhook with the fields left unset filled with the defaults of the server
+func withDefaults(webhook admissionregistrationv1.ValidatingWebhook) *admissionregistrationv1.ValidatingWebhook {
+	defaulted := webhook.DeepCopy()
+
+	if defaulted.FailurePolicy == nil {
+		policy := admissionregistrationv1.Fail
+		defaulted.FailurePolicy = &policy
+	}
+	if defaulted.MatchPolicy == nil {
+		policy := admissionregistrationv1.Equivalent
+		defaulted.MatchPolicy = &policy
+	}
+	if defaulted.NamespaceSelector == nil {
+		defaulted.NamespaceSelector = &metav1.LabelSelector{}
+	}
+	if defaulted.ObjectSelector == nil {
+		defaulted.ObjectSelector = &metav1.LabelSelector{}
+	}
+	if defaulted.TimeoutSeconds == nil {
+		timeout := defaultTimeoutSeconds
+		defaulted.TimeoutSeconds = &timeout
+	}
+	for i := range defaulted.Rules {
+		if defaulted.Rules[i].Scope == nil {
+			scope := admissionregistrationv1.AllScopes
+			defaulted.Rules[i].Scope = &scope
+		}
+	}
+	if service := defaulted.ClientConfig.Service; service != nil && service.Port == nil {
+		port := defaultServicePort
+		service.Port = &port
+	}
+
+	return defaulted
+}
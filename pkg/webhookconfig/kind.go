@@ -0,0 +1,37 @@
+package webhookconfig
+
+import (
+	"context"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	admissionregistration "k8s.io/client-go/kubernetes/typed/admissionregistration/v1"
+)
+
+// Client is the typed client of a kind of webhook configuration, C being the configuration and L its list. The
+// MutatingWebhookConfigurations and ValidatingWebhookConfigurations clients of client-go implement it.
+type Client[C, L any] interface {
+	Create(ctx context.Context, config *C, opts metav1.CreateOptions) (*C, error)
+	Update(ctx context.Context, config *C, opts metav1.UpdateOptions) (*C, error)
+	Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error
+	Get(ctx context.Context, name string, opts metav1.GetOptions) (*C, error)
+	List(ctx context.Context, opts metav1.ListOptions) (*L, error)
+}
+
+// Kind gives access to the parts of a kind of webhook configuration the shared code works on
+type Kind[C, L any] struct {
+	// Name is the kind of webhook in messages, mutating or validating
+	Name string
+	// Prefix is the route prefix of the endpoints the webhooks call
+	Prefix string
+	// Client returns the typed client of the configurations
+	Client func(v1 admissionregistration.AdmissionregistrationV1Interface) Client[C, L]
+	// Equal reports whether the current configuration, as returned by the server, is the desired one
+	Equal func(desired, current *C) bool
+	// Items returns the configurations of a list
+	Items func(list *L) []C
+	// ObjectMeta returns the metadata of a configuration
+	ObjectMeta func(config *C) *metav1.ObjectMeta
+	// ClientConfigs returns the client configuration of every webhook of a configuration
+	ClientConfigs func(config *C) []*admissionregistrationv1.WebhookClientConfig
+}
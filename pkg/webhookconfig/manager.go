@@ -0,0 +1,208 @@
+package webhookconfig
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/chungeun-choi/webhook/bootstrap/kubernetes"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	admissionregistration "k8s.io/client-go/kubernetes/typed/admissionregistration/v1"
+)
+
+type Config struct {
+	URL              string
+	Service          *admissionregistrationv1.ServiceReference // the webhooks call the service rather than the URL when set
+	Client           kubernetes.ClientInterface
+	AdmissionVersion []string
+	FailurePolicy    admissionregistrationv1.FailurePolicyType
+	CAPath           string
+	ManagedBy        string // value of the ManagedByLabel of the registered configurations, DefaultManagedBy when empty
+}
+
+// Manager registers the webhook configurations of a kind, C being the configuration and L its list
+type Manager[C, L any] struct {
+	Config             *Config                                                // Config is a struct that contains the URL, client, admission version, and failure policy
+	admissionInitGroup singleflight.Group                                     // single flight.Group is a struct that provides a duplicate function call suppression
+	admissionV1Client  admissionregistration.AdmissionregistrationV1Interface // Admission registrationV1Interface is an interface that contains the webhook configuration clients
+	once               sync.Once                                              // once is a struct that provides a mechanism for performing exactly one action
+	kind               Kind[C, L]
+	CAByte             []byte
+	caMu               sync.RWMutex // guards CAByte once the CA bundle is synced
+}
+
+// NewManager is a function that creates a new instance of Manager
+func NewManager[C, L any](config *Config, kind Kind[C, L]) *Manager[C, L] {
+	m := &Manager[C, L]{
+		Config: config,
+		kind:   kind,
+	}
+
+	// If CAPath is empty, use the default CA
+	if config.CAPath == "" {
+		log.Printf("CAPath is empty, using the default CA")
+		return m
+	}
+
+	// Try to read the CA file from the specified path
+	caBytes, err := os.ReadFile(config.CAPath)
+	if err != nil {
+		log.Printf("Failed to read CA file from %s: %v", config.CAPath, err)
+		return m
+	}
+	m.CAByte = caBytes
+
+	return m
+}
+
+// NewWebhook builds the fields of a webhook shared by every kind, unset options fall back to the defaults of the
+// server. The webhook calls the trigger route of the endpoint.
+func (m *Manager[C, L]) NewWebhook(name, endpoint string, opts Options) *WebhookBuilder {
+	sideEffects := opts.SideEffects
+	if sideEffects == "" {
+		sideEffects = admissionregistrationv1.SideEffectClassNone
+	}
+	failurePolicy := opts.FailurePolicy
+	if failurePolicy == "" {
+		failurePolicy = m.Config.FailurePolicy
+	}
+
+	builder := NewWebhookBuilder().
+		WithName(name).                                            // required
+		WithSideEffect(sideEffects).                               // required
+		WithAdmissionReviewVersions(m.Config.AdmissionVersion...). // required
+		WithRoles(opts.Rules...).WithFailurePolicy(failurePolicy).
+		WithNamespaceSelector(opts.NamespaceSelector).
+		WithObjectSelector(opts.ObjectSelector).
+		WithTimeoutSeconds(opts.TimeoutSeconds).
+		WithMatchPolicy(opts.MatchPolicy).
+		WithMatchConditions(opts.MatchConditions...)
+
+	path := fmt.Sprintf("/%s/%s/%s", m.kind.Prefix, endpoint, "trigger")
+	if m.Config.Service != nil {
+		return builder.WithServiceClientConfig(*m.Config.Service, path, m.CABundle()) // required
+	}
+
+	return builder.WithClientConfig(m.Config.URL, path, m.CABundle()) // required
+}
+
+// Apply creates the configuration, or updates it when the one on the server differs
+func (m *Manager[C, L]) Apply(desired *C) (*C, error) {
+	client, err := m.client()
+	if err != nil {
+		return nil, err
+	}
+
+	name := m.kind.ObjectMeta(desired).Name
+	current, err := client.Get(context.TODO(), name, meta.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, errors.Wrap(err, "failed to get old config")
+		}
+
+		created, err := client.Create(context.TODO(), desired, meta.CreateOptions{})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create new config.")
+		}
+		return created, nil
+	}
+
+	if m.kind.Equal(desired, current) {
+		log.Printf(" no need to update the configuration for the %s webhook %s", m.kind.Name, name)
+		return current, nil
+	}
+
+	m.kind.ObjectMeta(desired).ResourceVersion = m.kind.ObjectMeta(current).ResourceVersion
+	updated, err := client.Update(context.TODO(), desired, meta.UpdateOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to update the configuration for the %s webhook", m.kind.Name)
+	}
+
+	return updated, nil
+}
+
+// Fetch retrieves the configuration from the server
+func (m *Manager[C, L]) Fetch(name string) (*C, error) {
+	client, err := m.client()
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Get(context.TODO(), name, meta.GetOptions{})
+}
+
+// Delete is a method that deletes the configuration
+func (m *Manager[C, L]) Delete(name string) error {
+	client, err := m.client()
+	if err != nil {
+		return err
+	}
+
+	return client.Delete(context.TODO(), name, meta.DeleteOptions{})
+}
+
+// ManagedBy returns the value of the ManagedByLabel of the configurations registered by the manager
+func (m *Manager[C, L]) ManagedBy() string {
+	if m.Config.ManagedBy == "" {
+		return DefaultManagedBy
+	}
+
+	return m.Config.ManagedBy
+}
+
+// CABundle returns the CA bundle written into the registered configurations
+func (m *Manager[C, L]) CABundle() []byte {
+	m.caMu.RLock()
+	defer m.caMu.RUnlock()
+
+	return m.CAByte
+}
+
+// SyncCABundle replaces the CA bundle of the manager and writes it into every webhook of the configurations the
+// manager registered whose caBundle differs. It returns the names of the updated configurations, including those
+// updated before an error.
+func (m *Manager[C, L]) SyncCABundle(ctx context.Context, caBundle []byte) ([]string, error) {
+	m.caMu.Lock()
+	m.CAByte = caBundle
+	m.caMu.Unlock()
+
+	client, err := m.client()
+	if err != nil {
+		return nil, err
+	}
+
+	return SyncCABundle(ctx, client, m.kind, m.ManagedBy(), caBundle)
+}
+
+// GetAdmissionV1 is a method that returns the AdmissionregistrationV1Interface
+func (m *Manager[C, L]) GetAdmissionV1() (admissionregistration.AdmissionregistrationV1Interface, error) {
+	m.once.Do(func() {
+		// Do is a method that executes and returns the result of the function f.
+		v, err, _ := m.admissionInitGroup.Do("admissionV1", func() (interface{}, error) {
+			return m.Config.Client.AdmissionregistrationV1(), nil
+		})
+		if err == nil {
+			m.admissionV1Client = v.(admissionregistration.AdmissionregistrationV1Interface)
+		}
+	})
+	if m.admissionV1Client == nil {
+		return nil, fmt.Errorf("failed to initialize AdmissionregistrationV1 client")
+	}
+	return m.admissionV1Client, nil
+}
+
+// client returns the typed client of the configurations of the kind
+func (m *Manager[C, L]) client() (Client[C, L], error) {
+	v1, err := m.GetAdmissionV1()
+	if err != nil {
+		return nil, err
+	}
+
+	return m.kind.Client(v1), nil
+}
@@ -0,0 +1,106 @@
+package webhookconfig
+
+import "encoding/json"
+
+// Webhook is one webhook of a configuration holding several. Webhooks are called in the order they are listed. In
+// JSON the options are inlined next to the name and the endpoint.
+type Webhook[O any] struct {
+	Name     string // registered as <name>.<configuration>.admission.webhook
+	Endpoint string // endpoint called by the webhook, the name when empty
+	Options  O
+}
+
+// webhookFields are the fields of a Webhook besides its options
+type webhookFields struct {
+	Name     string `json:"name"`
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+func (w Webhook[O]) MarshalJSON() ([]byte, error) {
+	return marshalInline(webhookFields{Name: w.Name, Endpoint: w.Endpoint}, w.Options)
+}
+
+func (w *Webhook[O]) UnmarshalJSON(data []byte) error {
+	var fields webhookFields
+	if err := unmarshalInline(data, &fields, &w.Options); err != nil {
+		return err
+	}
+
+	w.Name, w.Endpoint = fields.Name, fields.Endpoint
+	return nil
+}
+
+// Request registers a configuration. Either Webhooks lists every webhook of the configuration, or the options are
+// given inline for a configuration with the single webhook <name>.admission.webhook calling the endpoint <name>.
+type Request[O any] struct {
+	Name     string
+	Options  O
+	Webhooks []Webhook[O]
+}
+
+// requestFields are the fields of a Request besides its inline options
+type requestFields[O any] struct {
+	Name     string       `json:"name"`
+	Webhooks []Webhook[O] `json:"webhooks,omitempty"`
+}
+
+func (r Request[O]) MarshalJSON() ([]byte, error) {
+	return marshalInline(requestFields[O]{Name: r.Name, Webhooks: r.Webhooks}, r.Options)
+}
+
+func (r *Request[O]) UnmarshalJSON(data []byte) error {
+	var fields requestFields[O]
+	if err := unmarshalInline(data, &fields, &r.Options); err != nil {
+		return err
+	}
+
+	r.Name, r.Webhooks = fields.Name, fields.Webhooks
+	return nil
+}
+
+// WebhooksOf returns the webhooks of the request in order, with their registered names and default endpoints
+func WebhooksOf[O any](req Request[O]) []Webhook[O] {
+	if len(req.Webhooks) == 0 {
+		return []Webhook[O]{{
+			Name:     WebhookName(req.Name, ""),
+			Endpoint: req.Name,
+			Options:  req.Options,
+		}}
+	}
+
+	webhooks := make([]Webhook[O], 0, len(req.Webhooks))
+	for _, webhook := range req.Webhooks {
+		if webhook.Endpoint == "" {
+			webhook.Endpoint = webhook.Name
+		}
+		webhook.Name = WebhookName(req.Name, webhook.Name)
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks
+}
+
+// marshalInline encodes fields and options as a single JSON object, fields taking precedence
+func marshalInline(fields, options any) ([]byte, error) {
+	object := map[string]json.RawMessage{}
+	for _, v := range []any{options, fields} {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &object); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(object)
+}
+
+// unmarshalInline decodes a single JSON object into both fields and options
+func unmarshalInline(data []byte, fields, options any) error {
+	if err := json.Unmarshal(data, fields); err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, options)
+}
@@ -0,0 +1,30 @@
+package webhookconfig
+
+import (
+	"errors"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ErrInvalidRequest is returned when the webhook configuration requested is invalid
+var ErrInvalidRequest = errors.New("invalid webhook configuration request")
+
+type Rule struct {
+	APIGroups   []string `json:"apiGroup"`
+	APIVersions []string `json:"apiVersion"`
+	Resources   []string `json:"resource"`
+	Operations  []string `json:"operations"`
+}
+
+// Options are the rules, selectors and admission settings shared by mutating and validating webhooks
+type Options struct {
+	Rules             []Rule                                    `json:"rules"`
+	NamespaceSelector *metav1.LabelSelector                     `json:"namespaceSelector,omitempty"`
+	ObjectSelector    *metav1.LabelSelector                     `json:"objectSelector,omitempty"`
+	SideEffects       admissionregistrationv1.SideEffectClass   `json:"sideEffects,omitempty"`   // None when empty
+	FailurePolicy     admissionregistrationv1.FailurePolicyType `json:"failurePolicy,omitempty"` // the failure policy of app.yml when empty
+	TimeoutSeconds    *int32                                    `json:"timeoutSeconds,omitempty"`
+	MatchPolicy       admissionregistrationv1.MatchPolicyType   `json:"matchPolicy,omitempty"`
+	MatchConditions   []admissionregistrationv1.MatchCondition  `json:"matchConditions,omitempty"`
+}
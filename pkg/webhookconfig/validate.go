@@ -0,0 +1,113 @@
+package webhookconfig
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// minTimeoutSeconds and maxTimeoutSeconds bound the timeout of a webhook call accepted by the API server
+	minTimeoutSeconds = 1
+	maxTimeoutSeconds = 30
+	// maxMatchConditions is the number of match conditions accepted by the API server
+	maxMatchConditions = 64
+)
+
+// ValidateRequest checks the fields of a registration request the API server would reject, so that a bad request
+// is reported before anything is created. Either the inline options are set, or every listed webhook has a unique
+// name and its own options, which are checked by validate.
+func ValidateRequest[O any](req Request[O], validate func(O) error) error {
+	if len(req.Webhooks) == 0 {
+		if err := validate(req.Options); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+		}
+		return nil
+	}
+
+	var empty O
+	if !reflect.DeepEqual(req.Options, empty) {
+		return fmt.Errorf("%w: webhook options must be set on every webhook when webhooks are listed", ErrInvalidRequest)
+	}
+
+	seen := sets.New[string]()
+	for i, webhook := range req.Webhooks {
+		if msgs := validation.IsDNS1123Label(webhook.Name); len(msgs) > 0 {
+			return fmt.Errorf("%w: webhooks[%d].name: %s", ErrInvalidRequest, i, strings.Join(msgs, ", "))
+		}
+		if seen.Has(webhook.Name) {
+			return fmt.Errorf("%w: webhooks[%d].name: duplicate name %q", ErrInvalidRequest, i, webhook.Name)
+		}
+		seen.Insert(webhook.Name)
+
+		if err := validate(webhook.Options); err != nil {
+			return fmt.Errorf("%w: webhooks[%d].%v", ErrInvalidRequest, i, err)
+		}
+	}
+
+	return nil
+}
+
+// ValidateOptions checks the options of a single webhook
+func ValidateOptions(opts Options) error {
+	if _, err := metav1.LabelSelectorAsSelector(opts.NamespaceSelector); err != nil {
+		return fmt.Errorf("namespaceSelector: %v", err)
+	}
+	if _, err := metav1.LabelSelectorAsSelector(opts.ObjectSelector); err != nil {
+		return fmt.Errorf("objectSelector: %v", err)
+	}
+
+	switch opts.SideEffects {
+	case "", admissionregistrationv1.SideEffectClassNone, admissionregistrationv1.SideEffectClassNoneOnDryRun:
+	default:
+		return fmt.Errorf("sideEffects must be None or NoneOnDryRun, not %q", opts.SideEffects)
+	}
+
+	switch opts.FailurePolicy {
+	case "", admissionregistrationv1.Ignore, admissionregistrationv1.Fail:
+	default:
+		return fmt.Errorf("failurePolicy must be Ignore or Fail, not %q", opts.FailurePolicy)
+	}
+
+	if t := opts.TimeoutSeconds; t != nil && (*t < minTimeoutSeconds || *t > maxTimeoutSeconds) {
+		return fmt.Errorf("timeoutSeconds must be between %d and %d, not %d", minTimeoutSeconds, maxTimeoutSeconds, *t)
+	}
+
+	switch opts.MatchPolicy {
+	case "", admissionregistrationv1.Exact, admissionregistrationv1.Equivalent:
+	default:
+		return fmt.Errorf("matchPolicy must be Exact or Equivalent, not %q", opts.MatchPolicy)
+	}
+
+	return validateMatchConditions(opts.MatchConditions)
+}
+
+// validateMatchConditions checks that the match conditions have unique qualified names and an expression. The
+// CEL expressions themselves are compiled and checked by the API server.
+func validateMatchConditions(conditions []admissionregistrationv1.MatchCondition) error {
+	if len(conditions) > maxMatchConditions {
+		return fmt.Errorf("matchConditions must have at most %d items", maxMatchConditions)
+	}
+
+	names := sets.New[string]()
+	for i, condition := range conditions {
+		if msgs := validation.IsQualifiedName(condition.Name); len(msgs) > 0 {
+			return fmt.Errorf("matchConditions[%d].name: %s", i, strings.Join(msgs, ", "))
+		}
+		if names.Has(condition.Name) {
+			return fmt.Errorf("matchConditions[%d].name: duplicate name %q", i, condition.Name)
+		}
+		names.Insert(condition.Name)
+
+		if condition.Expression == "" {
+			return fmt.Errorf("matchConditions[%d].expression is required", i)
+		}
+	}
+
+	return nil
+}